@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var blameCmdBranch string
+
+// Shows which commit last changed the data of a database
+var blameCmd = &cobra.Command{
+	Use:   "blame [database name] [file name]",
+	Short: "Show the commit which last changed the database",
+	Long: `Walks back through the history of a branch to find the most recent commit which actually changed the
+contents of the database, skipping over commits which left it as it was (eg licence changes).  A different file
+in the commit tree can be given instead of the database.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return blame(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(blameCmd)
+	blameCmd.Flags().StringVar(&blameCmdBranch, "branch", "",
+		"Branch to look through.  Defaults to the active branch")
+}
+
+func blame(args []string) error {
+	// Ensure a database file was given
+	var db string
+	var err error
+	if len(args) == 0 {
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+	} else {
+		db = args[0]
+	}
+	if len(args) > 2 {
+		return errors.New("Only one file can be looked at a time (for now)")
+	}
+	var fileName string
+	if len(args) == 2 {
+		fileName = args[1]
+	}
+
+	// If there is a local metadata cache for the requested database, use that.  Otherwise, retrieve it from the
+	// server first (without storing it)
+	meta, err := localFetchMetadata(db, true)
+	if err != nil {
+		return err
+	}
+	if len(meta.Branches) == 0 {
+		return fmt.Errorf("No local metadata for '%s' exists, and it's not on %s either", db, cloud)
+	}
+	branch := blameCmdBranch
+	if branch == "" {
+		branch = meta.ActiveBranch
+	}
+	head, ok := meta.Branches[branch]
+	if !ok {
+		return fmt.Errorf("That branch ('%s') doesn't exist", branch)
+	}
+
+	// Returns the checksum of the file being looked for in a commit, or "" if the commit doesn't have it
+	fileSHA := func(c commitEntry) string {
+		for _, e := range c.Tree.Entries {
+			if (fileName == "" && e.EntryType == DATABASE) || (fileName != "" && e.Name == fileName) {
+				return e.Sha256
+			}
+		}
+		return ""
+	}
+
+	// Walk back from the head until reaching a commit with different file contents to its parent
+	c, ok := meta.Commits[head.Commit]
+	if !ok {
+		return errors.New("Something has gone wrong.  Head commit for the branch isn't in the commit list")
+	}
+	shaSum := fileSHA(c)
+	if shaSum == "" {
+		if fileName != "" {
+			return fmt.Errorf("There's no file named '%s' in the head commit of branch '%s'", fileName, branch)
+		}
+		return fmt.Errorf("There's no database in the head commit of branch '%s'", branch)
+	}
+	for c.Parent != "" {
+		p, ok := meta.Commits[c.Parent]
+		if !ok {
+			return fmt.Errorf("Broken commit history: parent commit '%s' isn't in the commit list", c.Parent)
+		}
+		if fileSHA(p) != shaSum {
+			break
+		}
+		c = p
+	}
+
+	// Display the commit
+	l, err := getLicences()
+	if err != nil {
+		return err
+	}
+	licList := make(map[string]string)
+	for _, j := range l {
+		licList[j.Sha256] = j.FullName
+	}
+	name := fileName
+	if name == "" {
+		name = db
+	}
+	_, err = fmt.Fprintf(fOut, "Last change to '%s' on branch '%s':\n\n", name, branch)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(fOut, createCommitText(c, licList, false))
+	return err
+}
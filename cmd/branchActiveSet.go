@@ -93,7 +93,7 @@ func branchActiveSet(args []string) error {
 	lastMod := commit.Tree.Entries[0].LastModified
 
 	// Make sure the correct database from the target branch is in local cache
-	err = checkDBCache(db, shaSum)
+	err = checkDBCache(db, shaSum, head.Commit)
 	if err != nil {
 		return err
 	}
@@ -115,6 +115,7 @@ func branchActiveSet(args []string) error {
 
 	// Set the active branch
 	meta.ActiveBranch = branchActiveSetBranch
+	meta.CheckedOut = ""
 
 	// Save the updated metadata
 	err = saveMetadata(db, meta)
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var branchDiffBase, branchDiffBranch string
+var branchDiffShort bool
+
+// Lists the commits on one branch which aren't on another
+var branchDiffCmd = &cobra.Command{
+	Use:   "diff [database name] --branch xxx --base yyy",
+	Short: "List the commits on a branch which aren't on another branch",
+	Long: `Lists the commits reachable from the head of a branch, but not from the head of the base branch.  These
+are the commits a merge of the branch into the base branch would bring in.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return branchDiff(args)
+	},
+}
+
+func init() {
+	branchCmd.AddCommand(branchDiffCmd)
+	branchDiffCmd.Flags().StringVar(&branchDiffBase, "base", "",
+		"Branch to compare against.  Defaults to the default branch of the database")
+	branchDiffCmd.Flags().StringVar(&branchDiffBranch, "branch", "",
+		"Branch to list the commits of.  Defaults to the active branch")
+	branchDiffCmd.Flags().BoolVar(&branchDiffShort, "short", false,
+		"Display commit IDs in short form, and only the first line of commit messages")
+}
+
+func branchDiff(args []string) error {
+	// Ensure a database file was given
+	var db string
+	var err error
+	if len(args) == 0 {
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+	} else {
+		db = args[0]
+	}
+	if len(args) > 1 {
+		return errors.New("Only one database can be worked with at a time (for now)")
+	}
+
+	// If there is a local metadata cache for the requested database, use that.  Otherwise, retrieve it from the
+	// server first (without storing it)
+	meta, err := localFetchMetadata(db, true)
+	if err != nil {
+		return err
+	}
+	if len(meta.Branches) == 0 {
+		return fmt.Errorf("No local metadata for '%s' exists, and it's not on %s either", db, cloud)
+	}
+	branch, base := branchDiffBranch, branchDiffBase
+	if branch == "" {
+		branch = meta.ActiveBranch
+	}
+	if base == "" {
+		base = meta.DefBranch
+	}
+	if branch == base {
+		return fmt.Errorf("Both branches are '%s'.  Use --branch and --base to give two different ones", branch)
+	}
+	branchHead, ok := meta.Branches[branch]
+	if !ok {
+		return fmt.Errorf("That branch ('%s') doesn't exist", branch)
+	}
+	baseHead, ok := meta.Branches[base]
+	if !ok {
+		return fmt.Errorf("That branch ('%s') doesn't exist", base)
+	}
+
+	// Collect everything in the history of the base branch, then the commits of the branch which aren't in it
+	onBase := make(map[string]bool)
+	toCheck := []string{baseHead.Commit}
+	for len(toCheck) > 0 {
+		id := toCheck[0]
+		toCheck = toCheck[1:]
+		if onBase[id] {
+			continue
+		}
+		onBase[id] = true
+		if c, ok := meta.Commits[id]; ok {
+			if c.Parent != "" {
+				toCheck = append(toCheck, c.Parent)
+			}
+			toCheck = append(toCheck, c.OtherParents...)
+		}
+	}
+	var found []commitEntry
+	seen := make(map[string]bool)
+	toCheck = []string{branchHead.Commit}
+	for len(toCheck) > 0 {
+		id := toCheck[0]
+		toCheck = toCheck[1:]
+		if onBase[id] || seen[id] {
+			continue
+		}
+		seen[id] = true
+		c, ok := meta.Commits[id]
+		if !ok {
+			return fmt.Errorf("Broken commit history: commit '%s' isn't in the commit list", id)
+		}
+		found = append(found, c)
+		if c.Parent != "" {
+			toCheck = append(toCheck, c.Parent)
+		}
+		toCheck = append(toCheck, c.OtherParents...)
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return commitCommitterTime(found[i]).After(commitCommitterTime(found[j]))
+	})
+
+	// Display the commits
+	if len(found) == 0 {
+		_, err = fmt.Fprintf(fOut, "Branch '%s' has no commits which aren't on '%s'\n", branch, base)
+		return err
+	}
+	_, err = numFormat.Fprintf(fOut, "%d commit(s) on branch '%s' which aren't on '%s':\n\n", len(found), branch,
+		base)
+	if err != nil {
+		return err
+	}
+	l, err := getLicences()
+	if err != nil {
+		return err
+	}
+	licList := make(map[string]string)
+	for _, j := range l {
+		licList[j.Sha256] = j.FullName
+	}
+	for _, c := range found {
+		_, err = fmt.Fprint(fOut, createCommitText(c, licList, branchDiffShort))
+		if err != nil {
+			return err
+		}
+	}
+	if ancestor := commonAncestor(meta, branchHead.Commit, baseHead.Commit); ancestor != "" {
+		_, err = fmt.Fprintf(fOut, "The branches split at commit %s\n", ancestor)
+	}
+	return err
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// Displays the commit history for a database branch.  This is the same as "dio log", but grouped with the other
+// branch commands
+var branchHistoryCmd = &cobra.Command{
+	Use:   "history [database name] --branch xxx",
+	Short: "Displays the history for a database branch",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return branchLog(args)
+	},
+}
+
+func init() {
+	branchCmd.AddCommand(branchHistoryCmd)
+	branchHistoryCmd.Flags().StringVar(&logBranch, "branch", "", "Remote branch to retrieve the "+
+		"history of")
+	branchHistoryCmd.Flags().IntVar(&logLimit, "limit", 0, "Maximum number of commits to display")
+	branchHistoryCmd.Flags().BoolVar(&logShort, "short", false,
+		"Display commit IDs in short form, and only the first line of commit messages")
+	branchHistoryCmd.Flags().StringVar(&logSince, "since", "",
+		"Only show commits made at or after this time (RFC3339)")
+	branchHistoryCmd.Flags().StringVar(&logUntil, "until", "",
+		"Only show commits made at or before this time (RFC3339)")
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var branchListShort bool
+
 // Displays the list of branches for a remote database
 var branchListCmd = &cobra.Command{
 	Use:   "list [database name]",
@@ -22,6 +24,7 @@ var branchListCmd = &cobra.Command{
 
 func init() {
 	branchCmd.AddCommand(branchListCmd)
+	branchListCmd.Flags().BoolVar(&branchListShort, "short", false, "Display commit IDs in short form")
 }
 
 func branchList(args []string) error {
@@ -74,8 +77,20 @@ func branchList(args []string) error {
 	if err != nil {
 		return err
 	}
+	if len(sortedKeys) == 0 {
+		_, err = fmt.Fprint(fOut, "  No branches found\n\n")
+		return err
+	}
 	for _, i := range sortedKeys {
-		_, err = fmt.Fprintf(fOut, "  * '%s' - Commit: %s\n", i, meta.Branches[i].Commit)
+		commitID := meta.Branches[i].Commit
+		if branchListShort {
+			commitID = shortID(commitID)
+		}
+		var protected string
+		if isProtected(meta, i) {
+			protected = " (protected)"
+		}
+		_, err = fmt.Fprintf(fOut, "  * '%s' - Commit: %s%s\n", i, commitID, protected)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	branchProtectBranch string
+	branchProtectRemove bool
+)
+
+// Protects a branch, so its head can only move forward
+var branchProtectCmd = &cobra.Command{
+	Use:   "protect [database name] --branch xxx",
+	Short: "Protects a branch from having its history overwritten",
+	Long: `Marks a branch as protected.  The head of a protected branch can only be moved forward, to a commit
+which builds on the current head.  So it can't be reverted, force pushed, or removed.  Use --remove to take
+the protection off again.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return branchProtect(args)
+	},
+}
+
+func init() {
+	branchCmd.AddCommand(branchProtectCmd)
+	branchProtectCmd.Flags().StringVar(&branchProtectBranch, "branch", "", "Name of the branch to protect")
+	branchProtectCmd.Flags().BoolVar(&branchProtectRemove, "remove", false,
+		"Remove the protection from the branch, instead of adding it")
+}
+
+func branchProtect(args []string) error {
+	// Ensure a database file was given
+	var db string
+	var err error
+	var meta metaData
+	if len(args) == 0 {
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+	} else {
+		db = args[0]
+	}
+	if len(args) > 1 {
+		return errors.New("Only one database can be changed at a time (for now)")
+	}
+
+	// Ensure a branch name was given
+	if branchProtectBranch == "" {
+		return errors.New("No branch name given")
+	}
+
+	// Load the metadata
+	meta, err = loadMetadata(db)
+	if err != nil {
+		return err
+	}
+
+	// Check the branch exists
+	if _, ok := meta.Branches[branchProtectBranch]; !ok {
+		return errors.New("A branch with that name doesn't exist")
+	}
+
+	// Add or remove the branch from the protected list
+	protected := isProtected(meta, branchProtectBranch)
+	if branchProtectRemove {
+		if !protected {
+			return fmt.Errorf("Branch '%s' isn't protected", branchProtectBranch)
+		}
+		var newList []string
+		for _, j := range meta.Protected {
+			if j != branchProtectBranch {
+				newList = append(newList, j)
+			}
+		}
+		meta.Protected = newList
+	} else {
+		if protected {
+			return fmt.Errorf("Branch '%s' is already protected", branchProtectBranch)
+		}
+		meta.Protected = append(meta.Protected, branchProtectBranch)
+	}
+
+	// Save the updated metadata back to disk
+	err = saveMetadata(db, meta)
+	if err != nil {
+		return err
+	}
+
+	if branchProtectRemove {
+		_, err = fmt.Fprintf(fOut, "Branch '%s' is no longer protected\n", branchProtectBranch)
+	} else {
+		_, err = fmt.Fprintf(fOut, "Branch '%s' is now protected\n", branchProtectBranch)
+	}
+	return err
+}
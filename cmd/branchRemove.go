@@ -65,6 +65,12 @@ func branchRemove(args []string) error {
 		return errors.New("Can't remove the currently active branch.  You need to switch branches first")
 	}
 
+	// Protected branches need to be unprotected before they can be removed
+	if isProtected(meta, branchRemoveBranch) {
+		return fmt.Errorf("Branch '%s' is protected.  Use 'dio branch protect --remove' first if you really "+
+			"want to remove it", branchRemoveBranch)
+	}
+
 	// Remove the branch
 	delete(meta.Branches, branchRemoveBranch)
 
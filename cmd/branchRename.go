@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var branchRenameBranch, branchRenameNewName string
+
+// Renames a branch of a database
+var branchRenameCmd = &cobra.Command{
+	Use:   "rename [database name] --branch xxx --newname yyy",
+	Short: "Renames a branch of a database",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return branchRename(args)
+	},
+}
+
+func init() {
+	branchCmd.AddCommand(branchRenameCmd)
+	branchRenameCmd.Flags().StringVar(&branchRenameBranch, "branch", "", "Name of the branch to rename")
+	branchRenameCmd.Flags().StringVar(&branchRenameNewName, "newname", "", "New name for the branch")
+}
+
+func branchRename(args []string) error {
+	// Ensure a database file was given
+	var db string
+	var err error
+	var meta metaData
+	if len(args) == 0 {
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+	} else {
+		db = args[0]
+	}
+	if len(args) > 1 {
+		return errors.New("Only one database can be changed at a time (for now)")
+	}
+
+	// Ensure both the old and new branch names were given
+	if branchRenameBranch == "" {
+		return errors.New("No branch name given")
+	}
+	if branchRenameNewName == "" {
+		return errors.New("No new branch name given")
+	}
+
+	// Load the metadata
+	meta, err = loadMetadata(db)
+	if err != nil {
+		return err
+	}
+
+	// Check the branch exists, and the new name isn't already in use
+	br, ok := meta.Branches[branchRenameBranch]
+	if !ok {
+		return errors.New("A branch with that name doesn't exist")
+	}
+	if _, ok = meta.Branches[branchRenameNewName]; ok {
+		return fmt.Errorf("A branch named '%s' already exists", branchRenameNewName)
+	}
+
+	// The default branch is also recorded on the server, so renaming it locally would leave the two out of step
+	if branchRenameBranch == meta.DefBranch {
+		return errors.New("Can't rename the default branch of the database")
+	}
+
+	// Rename the branch, keeping it active if it was before
+	meta.Branches[branchRenameNewName] = br
+	delete(meta.Branches, branchRenameBranch)
+	if meta.ActiveBranch == branchRenameBranch {
+		meta.ActiveBranch = branchRenameNewName
+	}
+	for i, j := range meta.Protected {
+		if j == branchRenameBranch {
+			meta.Protected[i] = branchRenameNewName
+		}
+	}
+
+	// Save the updated metadata back to disk
+	err = saveMetadata(db, meta)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(fOut, "Branch '%s' renamed to '%s'\n", branchRenameBranch, branchRenameNewName)
+	return err
+}
@@ -138,6 +138,12 @@ func branchRevert(args []string) error {
 		return errors.New("The given commit or tag doesn't seem to exist on the selected branch")
 	}
 
+	// Protected branches can't have commits removed from them
+	if len(delList) > 0 && isProtected(meta, branchRevertBranch) {
+		return fmt.Errorf("Branch '%s' is protected, so it can't be reverted.  Use 'dio revert' to undo "+
+			"changes with a new commit instead", branchRevertBranch)
+	}
+
 	// Make sure the correct database from the target branch is in local cache
 	var shaSum string
 	var lastMod time.Time
@@ -146,7 +152,7 @@ func branchRevert(args []string) error {
 		lastMod = meta.Commits[branchRevertCommit].Tree.Entries[0].LastModified
 
 		// Fetch the database from DBHub.io if it's not in the local cache
-		err = checkDBCache(db, shaSum)
+		err = checkDBCache(db, shaSum, branchRevertCommit)
 		if err != nil {
 			return err
 		}
@@ -309,6 +315,7 @@ func branchRevert(args []string) error {
 		Description: head.Description,
 	}
 	meta.Branches[branchRevertBranch] = newHead
+	meta.CheckedOut = ""
 
 	// Copy the file from local cache to the working directory
 	var b []byte
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Work with the shared cache of downloaded database files",
+}
+
+func init() {
+	RootCmd.AddCommand(cacheCmd)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// Removes all of the database files from the shared cache
+var cacheCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove all database files from the shared download cache",
+	Long: `Removes the database files kept in ~/.dio/cache.  They're downloaded again when next needed.  The
+per-directory caches in .dio aren't touched, use 'dio gc' for those.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cacheClean()
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheCleanCmd)
+}
+
+func cacheClean() error {
+	if cacheDir == "" {
+		return errors.New("The location of the shared cache isn't known")
+	}
+	files, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			_, err = fmt.Fprintln(fOut, "The shared cache is already empty")
+		}
+		return err
+	}
+	var numFiles int
+	var numBytes int64
+	for _, j := range files {
+		if j.IsDir() {
+			continue
+		}
+		err = os.Remove(filepath.Join(cacheDir, j.Name()))
+		if err != nil {
+			return err
+		}
+		numFiles++
+		numBytes += j.Size()
+	}
+	_, err = numFormat.Fprintf(fOut, "%d cached file(s) removed, freeing %d bytes\n", numFiles, numBytes)
+	return err
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	catCmdOutput string
+	catCmdRemote bool
+)
+
+// Displays a stored commit, tree, or database file, for troubleshooting
+var catCmd = &cobra.Command{
+	Use:   "cat [database name] [object id]",
+	Short: "Display a stored commit, tree, or database file",
+	Long: `Displays the object with the given ID.  Commits and trees are shown as JSON.  For database files the
+size and checksum are shown, or the file can be written out with --output.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cat(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(catCmd)
+	catCmd.Flags().StringVarP(&catCmdOutput, "output", "o", "", "Write a database file to the given path")
+	catCmd.Flags().BoolVar(&catCmdRemote, "remote", false,
+		"Look up the object on the server, instead of in the local metadata")
+}
+
+func cat(args []string) error {
+	// Ensure an object ID was given, with an optional database name
+	var db, id string
+	var err error
+	switch len(args) {
+	case 1:
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+		id = args[0]
+	case 2:
+		db, id = args[0], args[1]
+	default:
+		return errors.New("An object ID is needed")
+	}
+
+	// Load the metadata, either from the local cache or the server
+	var meta metaData
+	if catCmdRemote {
+		var found bool
+		meta, found, err = retrieveMetadata(db)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("Database '%s' wasn't found on %s", db, cloud)
+		}
+	} else {
+		if _, err = os.Stat(filepath.Join(".dio", db, "metadata.json")); os.IsNotExist(err) {
+			return fmt.Errorf("No local metadata for '%s' exists.  Use --remote to look on %s", db, cloud)
+		}
+		meta, err = localFetchMetadata(db, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Commits
+	if c, ok := meta.Commits[id]; ok {
+		return catJSON(c)
+	}
+
+	// Trees, and the database files they refer to
+	var blobCommit string
+	for _, c := range meta.Commits {
+		if c.Tree.ID == id {
+			return catJSON(c.Tree)
+		}
+		for _, e := range c.Tree.Entries {
+			if e.Sha256 == id {
+				blobCommit = c.ID
+			}
+		}
+	}
+	if blobCommit == "" {
+		return fmt.Errorf("No commit, tree, or database file with ID '%s' is known for '%s'", id, db)
+	}
+
+	// Retrieve the database file
+	var b []byte
+	if catCmdRemote {
+		_, b, err = retrieveDatabase(db, "", blobCommit)
+		if err != nil {
+			return err
+		}
+	} else {
+		b, err = ioutil.ReadFile(filepath.Join(".dio", db, "db", id))
+		if os.IsNotExist(err) {
+			return fmt.Errorf("Database file '%s' isn't in the local cache.  Use --remote to retrieve it from %s",
+				id, cloud)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if catCmdOutput != "" {
+		err = ioutil.WriteFile(catCmdOutput, b, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = numFormat.Fprintf(fOut, "Database file %s written to '%s' (%d bytes)\n", id, catCmdOutput,
+			len(b))
+		return err
+	}
+	s := sha256.Sum256(b)
+	_, err = fmt.Fprintf(fOut, "Database file %s\n", id)
+	if err != nil {
+		return err
+	}
+	_, err = numFormat.Fprintf(fOut, "  * Size: %d bytes\n", len(b))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * SHA256: %s\n", hex.EncodeToString(s[:]))
+	return err
+}
+
+// Displays a commit or tree as indented JSON
+func catJSON(v interface{}) error {
+	j, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(fOut, string(j))
+	return err
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var checkoutCmdForce bool
+
+// Switches the database file to the version from a given branch, tag, or commit
+var checkoutCmd = &cobra.Command{
+	Use:   "checkout [database name] [branch, tag, or commit ID]",
+	Short: "Switch the database file to the version from a branch, tag, or commit",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return checkout(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(checkoutCmd)
+	checkoutCmd.Flags().BoolVarP(&checkoutCmdForce, "force", "f", false,
+		"Overwrite unsaved changes to the database?")
+}
+
+func checkout(args []string) error {
+	// Ensure a branch, tag, or commit was given, with an optional database name
+	var db, ref string
+	var err error
+	switch len(args) {
+	case 1:
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+		ref = args[0]
+	case 2:
+		db, ref = args[0], args[1]
+	default:
+		return errors.New("A branch name, tag name, or commit ID to check out is needed")
+	}
+
+	// Load the metadata
+	meta, err := loadMetadata(db)
+	if err != nil {
+		return err
+	}
+
+	// Look up the commit to check out
+	com, err := resolveCommit(meta, ref)
+	if err != nil {
+		return err
+	}
+	if len(com.Tree.Entries) == 0 {
+		return errors.New("Something has gone wrong.  The commit has no database in its tree")
+	}
+
+	// Unless --force is specified, check whether the file has changed since the last commit, and let the user know
+	if !checkoutCmdForce {
+		changed, err := dbChanged(db, meta)
+		if err != nil {
+			return err
+		}
+		if changed {
+			_, err = fmt.Fprintf(fOut, "%s has been changed since the last commit.  Use --force if you really want to "+
+				"overwrite it\n", db)
+			return err
+		}
+	}
+
+	// Make sure the database for the commit is in local cache
+	shaSum := com.Tree.Entries[0].Sha256
+	err = checkDBCache(db, shaSum, com.ID)
+	if err != nil {
+		return err
+	}
+
+	// Copy the database from local cache
+	b, err := ioutil.ReadFile(filepath.Join(".dio", db, "db", shaSum))
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(db, b, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Chtimes(db, time.Now(), com.Tree.Entries[0].LastModified)
+	if err != nil {
+		return err
+	}
+
+	// If a branch was given, it becomes the active branch
+	if _, ok := meta.Branches[ref]; ok {
+		meta.ActiveBranch = ref
+		meta.CheckedOut = ""
+		err = saveMetadata(db, meta)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(fOut, "Branch '%s' checked out for '%s'\n", ref, db)
+		return err
+	}
+
+	// A tag or commit was given, so the active branch stays the same.  The commit is recorded, so the database file
+	// is compared against it rather than the branch head
+	meta.CheckedOut = ""
+	if com.ID != meta.Branches[meta.ActiveBranch].Commit {
+		meta.CheckedOut = com.ID
+	}
+	err = saveMetadata(db, meta)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "Commit %s checked out for '%s'\n", com.ID, db)
+	if err != nil {
+		return err
+	}
+	if meta.CheckedOut != "" {
+		_, err = fmt.Fprintf(fOut, "  This isn't the head of the active branch ('%s'), so committing the database "+
+			"will add it as a new commit on top of the branch head\n", meta.ActiveBranch)
+	}
+	return err
+}
@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cloneCmdBranch, cloneCmdOutput string
+	cloneCmdForce                  bool
+)
+
+// Downloads a database and its full history from DBHub.io
+var cloneCmd = &cobra.Command{
+	Use:   "clone [database name]",
+	Short: "Download a database and its history from DBHub.io",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return clone(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(cloneCmd)
+	cloneCmd.Flags().StringVar(&cloneCmdBranch, "branch", "",
+		"Remote branch to clone.  Defaults to the default branch of the database")
+	cloneCmd.Flags().BoolVar(&cloneCmdForce, "force", false, "Overwrite an existing database file and metadata")
+	cloneCmd.Flags().StringVarP(&cloneCmdOutput, "output", "o", "",
+		"Path to write the database to, or - for standard output.  Defaults to the database name")
+}
+
+func clone(args []string) error {
+	// Ensure a database name was given
+	if len(args) == 0 {
+		return errors.New("No database name specified")
+	}
+	if len(args) > 1 {
+		return errors.New("Only one database can be cloned at a time (for now)")
+	}
+	db := args[0]
+
+	// Work out where the database should be written.  Local metadata is kept next to the database file, but only if
+	// the file keeps its name, as that's how dio finds the database on the server
+	toStdout := cloneCmdOutput == "-"
+	outDir, outFile := ".", db
+	if cloneCmdOutput != "" && !toStdout {
+		if fi, err := os.Stat(cloneCmdOutput); err == nil && fi.IsDir() {
+			outDir = cloneCmdOutput
+		} else {
+			outDir, outFile = filepath.Split(cloneCmdOutput)
+			if outDir == "" {
+				outDir = "."
+			}
+		}
+	}
+	keepMeta := !toStdout && outFile == db
+	outPath := filepath.Join(outDir, outFile)
+
+	// Refuse to overwrite existing local metadata or an existing database file, unless forced
+	if keepMeta {
+		if _, err := os.Stat(filepath.Join(outDir, ".dio", db, "metadata.json")); err == nil && !cloneCmdForce {
+			return fmt.Errorf("Local metadata for '%s' already exists.  Use 'dio pull' to update it instead, or "+
+				"--force to replace it", db)
+		}
+	}
+	if !toStdout {
+		if _, err := os.Stat(outPath); err == nil && !cloneCmdForce {
+			return fmt.Errorf("A file named '%s' already exists.  Use --force to overwrite it", outPath)
+		}
+	}
+
+	// Retrieve the metadata for the database
+	meta, found, err := retrieveMetadata(db)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("Database '%s' wasn't found on %s", db, cloud)
+	}
+
+	// If no branch name was given, use the default branch of the remote database
+	if cloneCmdBranch == "" {
+		cloneCmdBranch = meta.DefBranch
+	}
+	head, ok := meta.Branches[cloneCmdBranch]
+	if !ok {
+		return errors.New("The requested branch doesn't exist")
+	}
+	headCommit, ok := meta.Commits[head.Commit]
+	if !ok || len(headCommit.Tree.Entries) == 0 {
+		return errors.New("Something has gone wrong.  Head commit for the branch isn't in the commit list")
+	}
+
+	// Download the database file for the branch head, unless it's already in the shared cache
+	if !toStdout {
+		_, err = fmt.Fprintf(fOut, "Cloning '%s' from %s...\n", db, cloud)
+		if err != nil {
+			return err
+		}
+	}
+	shaSum := headCommit.Tree.Entries[0].Sha256
+	body, found, err := cacheRead(shaSum)
+	if err != nil {
+		return err
+	}
+	if !found {
+		_, body, err = retrieveDatabase(db, cloneCmdBranch, "")
+		if err != nil {
+			return err
+		}
+
+		// Verify the downloaded database matches the head commit of the branch
+		s := sha256.Sum256(body)
+		if thisSum := hex.EncodeToString(s[:]); thisSum != shaSum {
+			return fmt.Errorf("Aborting: downloaded database file should have checksum '%s', but data with "+
+				"checksum '%s' received", shaSum, thisSum)
+		}
+		err = cacheStore(shaSum, body)
+		if err != nil {
+			return err
+		}
+	}
+
+	// When streaming to standard output, there's nothing else to do
+	if toStdout {
+		_, err = fOut.Write(body)
+		return err
+	}
+
+	// Write the database file to its destination
+	err = ioutil.WriteFile(outPath, body, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Chtimes(outPath, time.Now(), headCommit.Tree.Entries[0].LastModified)
+	if err != nil {
+		return err
+	}
+	absPath, err := filepath.Abs(outPath)
+	if err != nil {
+		return err
+	}
+
+	// Write the database to the local cache, and save the metadata with the cloned branch as the active one
+	if keepMeta {
+		err = cloneSaveMetadata(outDir, db, shaSum, body, meta)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Let the user know where the database was saved, and which commit they now have
+	_, err = fmt.Fprintln(fOut, "Clone complete")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Path: %s\n", absPath)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Branch: '%s'\n", cloneCmdBranch)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Commit: %s\n", head.Commit)
+	if err != nil {
+		return err
+	}
+	_, err = numFormat.Fprintf(fOut, "  * Size: %d bytes\n", len(body))
+	if err != nil {
+		return err
+	}
+	if !keepMeta {
+		_, err = fmt.Fprintf(fOut, "  The database was saved under a different name, so no local metadata was kept "+
+			"for it\n")
+	}
+	return err
+}
+
+// Saves the clone to the local cache and metadata in the given directory, replacing any existing metadata
+func cloneSaveMetadata(dir string, db string, shaSum string, body []byte, meta metaData) (err error) {
+	// The metadata functions work relative to the current directory, so switch to the destination for them
+	if dir != "." {
+		var origDir string
+		origDir, err = os.Getwd()
+		if err != nil {
+			return
+		}
+		err = os.Chdir(dir)
+		if err != nil {
+			return
+		}
+		defer func() {
+			errInner := os.Chdir(origDir)
+			if err == nil {
+				err = errInner
+			}
+		}()
+	}
+	// Replace any existing metadata and cached files, but keep the reflogs so the earlier branch heads can still be
+	// found.  The commits they mention are carried over from the old metadata
+	ids, err := reflogCommits(db, time.Time{})
+	if err != nil {
+		return
+	}
+	var oldMeta metaData
+	if b, errInner := ioutil.ReadFile(filepath.Join(".dio", db, "metadata.json")); errInner == nil {
+		err = json.Unmarshal(b, &oldMeta)
+		if err != nil {
+			return
+		}
+	}
+	for _, id := range ids {
+		copyHistory(meta.Commits, oldMeta, id)
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(".dio", db))
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	for _, j := range entries {
+		if j.Name() == "logs" {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(".dio", db, j.Name()))
+		if err != nil {
+			return
+		}
+	}
+	err = os.MkdirAll(filepath.Join(".dio", db, "db"), 0770)
+	if err != nil {
+		return
+	}
+	err = writeFileAtomic(filepath.Join(".dio", db, "db", shaSum), body, 0644)
+	if err != nil {
+		return
+	}
+	meta.ActiveBranch = cloneCmdBranch
+	err = saveMetadata(db, meta)
+	if err != nil {
+		return
+	}
+
+	// If a default database isn't already selected, we use this one as the default
+	defDB, err := getDefaultDatabase()
+	if err != nil {
+		return
+	}
+	if defDB == "" {
+		err = saveDefaultDatabase(db)
+	}
+	return
+}
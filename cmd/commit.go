@@ -18,6 +18,7 @@ import (
 var (
 	commitCmdAuthEmail, commitCmdAuthName, commitCmdBranch, commitCmdCommit string
 	commitCmdLicence, commitCmdMsg, commitCmdTimestamp                      string
+	commitCmdAllowEmpty, commitCmdNoEdit, commitCmdSign                     bool
 )
 
 // Create a commit for the database on the currently active branch
@@ -33,6 +34,8 @@ var (
 
 func init() {
 	RootCmd.AddCommand(commitCmd)
+	commitCmd.Flags().BoolVar(&commitCmdAllowEmpty, "allow-empty", false,
+		"Create the commit even if the database is unchanged from the previous one")
 	commitCmd.Flags().StringVar(&commitCmdBranch, "branch", "",
 		"The branch this commit will be appended to")
 	commitCmd.Flags().StringVar(&commitCmdCommit, "commit", "",
@@ -44,6 +47,10 @@ func init() {
 	commitCmd.Flags().StringVar(&commitCmdMsg, "message", "",
 		"Description / commit message")
 	commitCmd.Flags().StringVar(&commitCmdAuthName, "name", "", "Name of the commit author")
+	commitCmd.Flags().BoolVar(&commitCmdNoEdit, "no-edit", false,
+		"Don't open an editor for the commit message when --message isn't given")
+	commitCmd.Flags().BoolVar(&commitCmdSign, "sign", false,
+		"Sign the commit with the private key of your client certificate")
 	commitCmd.Flags().StringVar(&commitCmdTimestamp, "timestamp", "", "Timestamp for the commit")
 }
 
@@ -75,6 +82,10 @@ func commit(args []string) error {
 	if err != nil {
 		return err
 	}
+	err = checkSQLiteHeader(db)
+	if err != nil {
+		return err
+	}
 
 	// Grab author name & email from the dio config file, but allow command line flags to override them
 	var authorName, authorEmail, committerName, committerEmail string
@@ -101,7 +112,7 @@ func commit(args []string) error {
 	// If a timestamp was provided, make sure it parses ok
 	commitTime := time.Now()
 	if commitCmdTimestamp != "" {
-		commitTime, err = time.Parse(time.RFC3339, commitCmdTimestamp)
+		commitTime, err = checkCommitTime(commitCmdTimestamp)
 		if err != nil {
 			return err
 		}
@@ -152,7 +163,7 @@ func commit(args []string) error {
 		if err != nil {
 			return err
 		}
-		if !changed && commitCmdLicence == "" {
+		if !changed && commitCmdLicence == "" && !commitCmdAllowEmpty {
 			return fmt.Errorf("Database is unchanged from last commit.  No need to commit anything.")
 		}
 	}
@@ -208,7 +219,10 @@ func commit(args []string) error {
 		licSHA = existingLicSHA
 	}
 
-	// Generate an appropriate commit message if none was provided
+	// Generate an appropriate commit message if none was provided.  Unless --no-edit was given, the user gets to
+	// change it in their editor before it's used
+	commitCmdMsg = normaliseMessage(commitCmdMsg)
+	editMsg := commitCmdMsg == "" && !commitCmdNoEdit
 	if commitCmdMsg == "" {
 		if !newDB && existingLicSHA != licSHA {
 			// * The licence has changed, so we create a reasonable commit message indicating this *
@@ -271,6 +285,35 @@ func commit(args []string) error {
 	t.Entries = append(t.Entries, e)
 	t.ID = createDBTreeID(t.Entries)
 
+	// If no message was given on the command line, open an editor for the user to write one
+	if editMsg {
+		var changes []string
+		if prev, ok := meta.Commits[head.Commit]; ok && len(prev.Tree.Entries) > 0 {
+			p := prev.Tree.Entries[0]
+			if p.Sha256 != e.Sha256 {
+				changes = append(changes, numFormat.Sprintf("modified: %s (%d -> %d bytes)", db, p.Size, e.Size))
+			}
+			if p.LicenceSHA != e.LicenceSHA {
+				oldLic, newLic := p.LicenceSHA, e.LicenceSHA
+				for i, j := range licList {
+					if j.Sha256 == p.LicenceSHA {
+						oldLic = i
+					}
+					if j.Sha256 == e.LicenceSHA {
+						newLic = i
+					}
+				}
+				changes = append(changes, fmt.Sprintf("licence: '%s' -> '%s'", oldLic, newLic))
+			}
+		} else {
+			changes = append(changes, numFormat.Sprintf("new database: %s (%d bytes)", db, e.Size))
+		}
+		commitCmdMsg, err = editMessage(db, commitCmdBranch, commitCmdMsg, changes)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Create a new commit for the new tree
 	newCom := commitEntry{
 		AuthorName:     authorName,
@@ -286,6 +329,14 @@ func commit(args []string) error {
 	// Calculate the new commit ID, which incorporates the updated tree ID (and thus the new licence sha256)
 	newCom.ID = createCommitID(newCom)
 
+	// If requested, sign the new commit.  The signature isn't part of the commit ID
+	if commitCmdSign {
+		newCom.Signature, newCom.SigningKeyID, err = signCommit(newCom)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Add the new commit info to the database commit list
 	meta.Commits[newCom.ID] = newCom
 
@@ -304,12 +355,17 @@ func commit(args []string) error {
 				return err
 			}
 		}
-		err = ioutil.WriteFile(filepath.Join(".dio", db, "db", shaSum), b, 0644)
+		err = writeFileAtomic(filepath.Join(".dio", db, "db", shaSum), b, 0644)
 		if err != nil {
 			return err
 		}
 	}
 
+	// The database file is now the head of the branch, rather than any other commit which was checked out
+	if commitCmdBranch == meta.ActiveBranch {
+		meta.CheckedOut = ""
+	}
+
 	// Save the updated metadata back to disk
 	err = saveMetadata(db, meta)
 	if err != nil {
@@ -329,6 +385,12 @@ func commit(args []string) error {
 	if err != nil {
 		return err
 	}
+	if newCom.Signature != "" {
+		_, err = fmt.Fprintf(fOut, "    Signed with key: %s\n", shortID(newCom.SigningKeyID))
+		if err != nil {
+			return err
+		}
+	}
 	if licID != "" {
 		_, err = fmt.Fprintf(fOut, "    Licence: %s\n", licID)
 		if err != nil {
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The user friendly names for the settings in the dio config file
+var configKeys = map[string]string{
+	"author":   "user.name",
+	"cacert":   "certs.cachain",
+	"cert":     "certs.cert",
+	"cloud":    "general.cloud",
+	"editor":   "user.editor",
+	"email":    "user.email",
+	"template": "user.template",
+}
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "View and change the settings in the dio config file",
+}
+
+func init() {
+	RootCmd.AddCommand(configCmd)
+}
+
+// Returns the config file key for a user friendly setting name
+func configKey(name string) (string, error) {
+	key, ok := configKeys[strings.ToLower(name)]
+	if !ok {
+		var names []string
+		for i := range configKeys {
+			names = append(names, i)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("Unknown setting '%s'.  Known settings are: %s", name, strings.Join(names, ", "))
+	}
+	return key, nil
+}
+
+// Loads the config file by itself, so values added at run time (eg the email address from the client certificate)
+// aren't mixed in with the ones actually saved in it
+func loadConfigFile() (*viper.Viper, error) {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		path = cfgFile
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	err := v.ReadInConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read the config file '%s': %s", path, err)
+	}
+	return v, nil
+}
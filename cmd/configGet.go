@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// Displays a setting from the dio config file
+var configGetCmd = &cobra.Command{
+	Use:   "get [setting]",
+	Short: "Displays a setting from the dio config file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return configGet(args)
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configGetCmd)
+}
+
+func configGet(args []string) error {
+	// Ensure a setting name was given
+	if len(args) == 0 {
+		return errors.New("No setting name specified")
+	}
+	if len(args) > 1 {
+		return errors.New("Only one setting can be displayed at a time (for now)")
+	}
+	key, err := configKey(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Display the saved value
+	v, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	if !v.IsSet(key) {
+		return fmt.Errorf("'%s' isn't set in the config file", args[0])
+	}
+	_, err = fmt.Fprintln(fOut, v.GetString(key))
+	return err
+}
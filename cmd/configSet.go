@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Changes a setting in the dio config file
+var configSetCmd = &cobra.Command{
+	Use:   "set [setting] [value]",
+	Short: "Changes a setting in the dio config file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return configSet(args)
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configSetCmd)
+}
+
+func configSet(args []string) error {
+	// Ensure a setting name and value were given
+	if len(args) != 2 {
+		return errors.New("A setting name and its new value are needed")
+	}
+	key, err := configKey(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Update the config file
+	v, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	v.Set(key, args[1])
+	err = v.WriteConfig()
+	if err != nil {
+		return err
+	}
+
+	// Use the new value for the rest of this run as well
+	viper.Set(key, args[1])
+	_, err = fmt.Fprintf(fOut, "'%s' set to '%s'\n", args[0], args[1])
+	return err
+}
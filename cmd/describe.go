@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+// The longest description the server accepts for a database
+const maxDescriptionLen = 4096
+
+// Displays or changes the description of a database on DBHub.io
+var describeCmd = &cobra.Command{
+	Use:   "describe [database name] [description]",
+	Short: "Display or change the description of a database on DBHub.io",
+	Long: `Displays the description of a database on DBHub.io.  If a description is given as well, it replaces the
+existing one.  An empty description ("") removes it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return describe(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(describeCmd)
+}
+
+func describe(args []string) error {
+	// Ensure a database file was given
+	var db string
+	var err error
+	if len(args) == 0 {
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+	} else {
+		db = args[0]
+	}
+	if len(args) > 2 {
+		return errors.New("Only one database can be described at a time (for now).  If the description has " +
+			"spaces in it, put quotes around it")
+	}
+
+	// If no new description was given, display the existing one
+	if len(args) < 2 {
+		dbList, err := getDatabases(cloud, certUser)
+		if err != nil {
+			return err
+		}
+		for _, j := range dbList {
+			if j.Name != db {
+				continue
+			}
+			if j.Description == "" {
+				_, err = fmt.Fprintf(fOut, "Database '%s' has no description\n", db)
+				return err
+			}
+			_, err = fmt.Fprintf(fOut, "Description of '%s':\n\n%s\n", db, j.Description)
+			return err
+		}
+		return fmt.Errorf("Database '%s' wasn't found on %s", db, cloud)
+	}
+
+	// Strip out any control characters (apart from new lines and tabs), then make sure it's not too long
+	desc := strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, args[1]))
+	if len(desc) > maxDescriptionLen {
+		return errors.New(numFormat.Sprintf("The description is too long.  It can be up to %d bytes, but is %d",
+			maxDescriptionLen, len(desc)))
+	}
+
+	// Send the new description to the server
+	client, err := newTLSClient()
+	if err != nil {
+		return err
+	}
+	resp, body, errs := withToken(client.Post(fmt.Sprintf("%s/db_describe", cloud)).
+		Query(fmt.Sprintf("dbname=%s", url.QueryEscape(db))).
+		Query(fmt.Sprintf("description=%s", url.QueryEscape(desc))).
+		Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION))).
+		End()
+	if errs != nil {
+		if err = timeoutError(errs); err != nil {
+			return err
+		}
+		e := fmt.Sprintln("Errors when changing the database description:")
+		for _, err := range errs {
+			e += err.Error()
+		}
+		return errors.New(e)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("Database '%s' wasn't found on %s, or the server doesn't support descriptions", db,
+			cloud)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Couldn't change the description of '%s': HTTP status %d - '%v'", db,
+			resp.StatusCode, body)
+	}
+	if desc == "" {
+		_, err = fmt.Fprintf(fOut, "Description of '%s' removed\n", db)
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "Description of '%s' updated\n", db)
+	return err
+}
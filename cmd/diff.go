@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Displays the differences between the trees of two commits
+var diffCmd = &cobra.Command{
+	Use:   "diff [database name] [commit or branch] [commit or branch]",
+	Short: "Show the differences between two commits of a database",
+	Long: `Shows the differences between two commits (or branches) of a database.  If no commits are given, the
+database file is compared with the head commit of the active branch instead, to show what has changed since
+it was last committed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return diff(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(diffCmd)
+}
+
+func diff(args []string) error {
+	// Ensure two commits (or branches) were given, with an optional database name
+	var db, from, to string
+	var err error
+	switch len(args) {
+	case 0, 1:
+		// With no commits given, compare the database file with the head of the active branch
+		if len(args) == 1 {
+			return diffWorking(args[0])
+		}
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+		return diffWorking(db)
+	case 2:
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+		from, to = args[0], args[1]
+	case 3:
+		db, from, to = args[0], args[1], args[2]
+	default:
+		return errors.New("Too many arguments.  Two commit IDs or branch names are needed to compare")
+	}
+
+	// If there is a local metadata cache for the requested database, use that.  Otherwise, retrieve it from the
+	// server first (without storing it)
+	meta, err := localFetchMetadata(db, true)
+	if err != nil {
+		return err
+	}
+
+	// Look up the commits to compare
+	fromCommit, err := resolveCommit(meta, from)
+	if err != nil {
+		return err
+	}
+	toCommit, err := resolveCommit(meta, to)
+	if err != nil {
+		return err
+	}
+
+	// Index the tree entries of both commits by name
+	oldEntries := make(map[string]dbTreeEntry)
+	for _, j := range fromCommit.Tree.Entries {
+		oldEntries[j.Name] = j
+	}
+	newEntries := make(map[string]dbTreeEntry)
+	var names []string
+	for _, j := range toCommit.Tree.Entries {
+		newEntries[j.Name] = j
+		names = append(names, j.Name)
+	}
+	for name := range oldEntries {
+		if _, ok := newEntries[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// Display the differences
+	_, err = fmt.Fprintf(fOut, "Changes from '%s' to '%s' for %s:\n\n", from, to, db)
+	if err != nil {
+		return err
+	}
+	numChanged := 0
+	for _, name := range names {
+		oldEntry, inOld := oldEntries[name]
+		newEntry, inNew := newEntries[name]
+		switch {
+		case !inOld:
+			numChanged++
+			_, err = numFormat.Fprintf(fOut, "  * Added: %s (%d bytes)\n", name, newEntry.Size)
+			if err != nil {
+				return err
+			}
+		case !inNew:
+			numChanged++
+			_, err = numFormat.Fprintf(fOut, "  * Removed: %s (%d bytes)\n", name, oldEntry.Size)
+			if err != nil {
+				return err
+			}
+		default:
+			if oldEntry.Sha256 == newEntry.Sha256 && oldEntry.Size == newEntry.Size &&
+				oldEntry.LicenceSHA == newEntry.LicenceSHA && oldEntry.LastModified.Equal(newEntry.LastModified) {
+				continue
+			}
+			numChanged++
+			_, err = fmt.Fprintf(fOut, "  * Modified: %s\n", name)
+			if err != nil {
+				return err
+			}
+			err = diffEntryDetails(oldEntry, newEntry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if numChanged == 0 {
+		_, err = fmt.Fprintln(fOut, "  No differences")
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintln(fOut)
+	return err
+}
+
+// Displays the changes made to the database file since the commit it was checked out from, which is normally the
+// head of the active branch
+func diffWorking(db string) error {
+	if _, err := os.Stat(filepath.Join(".dio", db, "metadata.json")); os.IsNotExist(err) {
+		return fmt.Errorf("No local metadata for '%s' exists, so there's no commit to compare it with", db)
+	}
+	meta, err := localFetchMetadata(db, false)
+	if err != nil {
+		return err
+	}
+	headCommit, err := workingCommit(meta)
+	if err != nil {
+		return err
+	}
+	var oldEntry dbTreeEntry
+	for _, e := range headCommit.Tree.Entries {
+		if e.EntryType == DATABASE {
+			oldEntry = e
+		}
+	}
+
+	// Gather the details of the database file, in the same form as a tree entry
+	fi, err := os.Stat(db)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("The database file '%s' doesn't exist", db)
+	}
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(db)
+	if err != nil {
+		return err
+	}
+	z := sha256.Sum256(b)
+	newEntry := dbTreeEntry{
+		EntryType:    DATABASE,
+		LastModified: fi.ModTime().Truncate(time.Second).UTC(),
+		LicenceSHA:   oldEntry.LicenceSHA,
+		Name:         db,
+		Sha256:       hex.EncodeToString(z[:]),
+		Size:         int64(len(b)),
+	}
+
+	// Display the differences
+	if meta.CheckedOut != "" {
+		_, err = fmt.Fprintf(fOut, "Changes to %s since the checked out commit (%s):\n\n", db,
+			shortID(headCommit.ID))
+	} else {
+		_, err = fmt.Fprintf(fOut, "Changes to %s since the head of branch '%s' (%s):\n\n", db, meta.ActiveBranch,
+			shortID(headCommit.ID))
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case oldEntry.Sha256 == "":
+		_, err = numFormat.Fprintf(fOut, "  * Added: %s (%d bytes)\n", db, newEntry.Size)
+	case oldEntry.Sha256 == newEntry.Sha256:
+		_, err = fmt.Fprintln(fOut, "  No differences")
+	default:
+		_, err = fmt.Fprintf(fOut, "  * Modified: %s\n", db)
+		if err != nil {
+			return err
+		}
+		err = diffEntryDetails(oldEntry, newEntry)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Files which aren't SQLite databases can't be committed, so point that out
+	if err = checkSQLiteHeader(db); err != nil {
+		_, err = fmt.Fprintf(fOut, "\n  Warning: '%s' doesn't seem to be an SQLite database any more, so it can't be "+
+			"committed\n", db)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintln(fOut)
+	return err
+}
+
+// Displays what changed between two versions of the same tree entry
+func diffEntryDetails(oldEntry dbTreeEntry, newEntry dbTreeEntry) (err error) {
+	if oldEntry.Sha256 != newEntry.Sha256 {
+		_, err = fmt.Fprintf(fOut, "      Contents changed: %s -> %s\n", oldEntry.Sha256, newEntry.Sha256)
+		if err != nil {
+			return
+		}
+	}
+	if oldEntry.Size != newEntry.Size {
+		_, err = numFormat.Fprintf(fOut, "      Size: %d -> %d bytes (%+d bytes)\n", oldEntry.Size, newEntry.Size,
+			newEntry.Size-oldEntry.Size)
+		if err != nil {
+			return
+		}
+	}
+	if oldEntry.LicenceSHA != newEntry.LicenceSHA {
+		_, err = fmt.Fprintln(fOut, "      Licence changed")
+		if err != nil {
+			return
+		}
+	}
+	if !oldEntry.LastModified.Equal(newEntry.LastModified) {
+		_, err = fmt.Fprintf(fOut, "      Last modified: %s -> %s\n",
+			oldEntry.LastModified.Local().Format(time.RFC1123), newEntry.LastModified.Local().Format(time.RFC1123))
+	}
+	return
+}
@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
 	"flag"
@@ -17,6 +16,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"testing"
@@ -48,9 +48,13 @@ name = "Some One"
 )
 
 var (
-	_       = chk.Suite(&DioSuite{})
-	licFile string
-	licList = map[string]licenceEntry{"Not specified": {
+	_           = chk.Suite(&DioSuite{})
+	editorMsg   string // Message the mock editor saves
+	editorTmpl  string // Commit message template the mock editor was last opened on
+	lastAuth    string // Authorization header of the last database list request received by the mock server
+	lastIdemKey string // Idempotency-Key header of the last new database upload received by the mock server
+	licFile     string
+	licList     = map[string]licenceEntry{"Not specified": {
 		FileFormat: "text",
 		FullName:   "No licence specified",
 		Order:      100,
@@ -120,21 +124,11 @@ func (s *DioSuite) SetUpSuite(c *chk.C) {
 	cloud = viper.GetString("general.cloud")
 
 	// Use our testing certificates
-	ourCAPool := x509.NewCertPool()
-	chainFile, err := ioutil.ReadFile(filepath.Join(d, "..", "test_data", "ca-chain-docker.cert.pem"))
+	TLSConfig, err = loadTLSConfig(filepath.Join(d, "..", "test_data", "ca-chain-docker.cert.pem"),
+		filepath.Join(d, "..", "test_data", "default.cert.pem"))
 	if err != nil {
 		log.Fatalln(err)
 	}
-	ok := ourCAPool.AppendCertsFromPEM(chainFile)
-	if !ok {
-		log.Fatalln("Error when loading certificate chain file")
-	}
-	testCert := filepath.Join(d, "..", "test_data", "default.cert.pem")
-	cert, err := tls.LoadX509KeyPair(testCert, testCert)
-	if err != nil {
-		log.Fatalln(err)
-	}
-	TLSConfig.Certificates = []tls.Certificate{cert}
 	var email string
 	certUser, email, _, err = getUserAndServer()
 	if err != nil {
@@ -172,6 +166,8 @@ func (s *DioSuite) SetUpSuite(c *chk.C) {
 	}
 
 	// If not told otherwise, redirect command output to /dev/null
+	launchEditor = mockLaunchEditor
+
 	if !*showFlag {
 		fOut, err = os.OpenFile(os.DevNull, os.O_APPEND|os.O_WRONLY, 0644)
 		if err != nil {
@@ -216,6 +212,227 @@ func (s *DioSuite) TearDownTest(c *chk.C) {
 	s.buf.Reset()
 }
 
+// Test the generation of commit IDs with separate author and committer times
+func (s *DioSuite) Test0001_CommitIDTimestamps(c *chk.C) {
+	com := commitEntry{
+		AuthorEmail:    "testdefault@dbhub.io",
+		AuthorName:     "Default test user",
+		CommitterEmail: "someone@example.org",
+		CommitterName:  "Some One",
+		Message:        "Test message",
+		Timestamp:      time.Date(2019, time.March, 15, 18, 1, 1, 0, time.UTC),
+		Tree:           dbTree{ID: "8983130ceda4a2e39a3ad002945d57748987494907f475539fe766f8893cc278"},
+	}
+	origID := createCommitID(com)
+
+	// Setting both new fields to the existing timestamp shouldn't change the ID
+	com.AuthorTimestamp = com.Timestamp
+	com.CommitterTimestamp = com.Timestamp
+	c.Check(createCommitID(com), chk.Equals, origID)
+
+	// A different committer time should change it
+	com.CommitterTimestamp = com.Timestamp.Add(time.Hour)
+	c.Check(createCommitID(com), chk.Not(chk.Equals), origID)
+	c.Check(commitAuthorTime(com), chk.Equals, com.Timestamp)
+	c.Check(commitCommitterTime(com), chk.Equals, com.Timestamp.Add(time.Hour))
+}
+
+// Test signing a commit, which shouldn't change its ID
+func (s *DioSuite) Test0002_CommitSignature(c *chk.C) {
+	com := commitEntry{
+		AuthorEmail: "testdefault@dbhub.io",
+		AuthorName:  "Default test user",
+		Message:     "Test message",
+		Timestamp:   time.Date(2019, time.March, 15, 18, 1, 1, 0, time.UTC),
+		Tree:        dbTree{ID: "8983130ceda4a2e39a3ad002945d57748987494907f475539fe766f8893cc278"},
+	}
+	com.ID = createCommitID(com)
+	var err error
+	com.Signature, com.SigningKeyID, err = signCommit(com)
+	c.Assert(err, chk.IsNil)
+	c.Check(com.Signature, chk.Not(chk.Equals), "")
+	c.Check(createCommitID(com), chk.Equals, com.ID)
+	c.Check(verifyCommitSignature(com), chk.IsNil)
+
+	// A signature for a different commit shouldn't be accepted
+	com.ID = createCommitID(commitEntry{Message: "Different commit"})
+	c.Check(verifyCommitSignature(com), chk.Not(chk.IsNil))
+}
+
+// Test that writeFileAtomic() replaces the destination file without leaving temporary files behind
+func (s *DioSuite) Test0003_WriteFileAtomic(c *chk.C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "test.json")
+	err := ioutil.WriteFile(path, []byte("old contents"), 0644)
+	c.Assert(err, chk.IsNil)
+	err = writeFileAtomic(path, []byte("new contents"), 0644)
+	c.Assert(err, chk.IsNil)
+	b, err := ioutil.ReadFile(path)
+	c.Assert(err, chk.IsNil)
+	c.Check(string(b), chk.Equals, "new contents")
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, chk.IsNil)
+	c.Check(files, chk.HasLen, 1)
+}
+
+// Test that tree and commit IDs don't depend on the location or precision of their timestamps
+func (s *DioSuite) Test0004_IDTimestampNormalisation(c *chk.C) {
+	base := time.Date(2019, time.March, 15, 18, 1, 1, 0, time.UTC)
+	entry := dbTreeEntry{
+		EntryType:    DATABASE,
+		LastModified: base,
+		Name:         s.dbName,
+		Sha256:       "e8cab91dec32b3990b427b28380e4e052288054f99c4894742f07dee0c924efd",
+		Size:         19456,
+	}
+	treeID := createDBTreeID([]dbTreeEntry{entry})
+	com := commitEntry{
+		AuthorEmail: "testdefault@dbhub.io",
+		AuthorName:  "Default test user",
+		Message:     "Test message",
+		Timestamp:   base,
+		Tree:        dbTree{ID: treeID},
+	}
+	comID := createCommitID(com)
+
+	// The same moment in other locations, or with sub-second precision, should give the same IDs
+	for _, t := range []time.Time{
+		base.In(time.FixedZone("AEDT", 11*60*60)),
+		base.Add(250 * time.Millisecond),
+		base.In(time.FixedZone("PDT", -7*60*60)).Add(999 * time.Nanosecond),
+	} {
+		entry.LastModified = t
+		c.Check(createDBTreeID([]dbTreeEntry{entry}), chk.Equals, treeID)
+		com.Timestamp = t
+		c.Check(createCommitID(com), chk.Equals, comID)
+	}
+
+	// A monotonic clock reading shouldn't make a difference either
+	now := time.Now()
+	entry.LastModified = now
+	com.Timestamp = now
+	treeID = createDBTreeID([]dbTreeEntry{entry})
+	comID = createCommitID(com)
+	entry.LastModified = now.Round(0).UTC()
+	com.Timestamp = now.Round(0).UTC()
+	c.Check(createDBTreeID([]dbTreeEntry{entry}), chk.Equals, treeID)
+	c.Check(createCommitID(com), chk.Equals, comID)
+}
+
+// Test the "dio commit" command with a file which isn't an SQLite database (should fail)
+func (s *DioSuite) Test0005_CommitNotSQLite(c *chk.C) {
+	notDB := filepath.Join(tempDir, "notadb.csv")
+	err := ioutil.WriteFile(notDB, []byte("id,name\n1,foo\n"), 0644)
+	c.Assert(err, chk.IsNil)
+	err = commit([]string{notDB})
+	c.Check(err, chk.ErrorMatches, ".*doesn't seem to be an SQLite database")
+	err = os.Remove(notDB)
+	c.Assert(err, chk.IsNil)
+
+	// Empty files should be rejected too
+	emptyDB := filepath.Join(tempDir, "empty.sqlite")
+	err = ioutil.WriteFile(emptyDB, nil, 0644)
+	c.Assert(err, chk.IsNil)
+	err = commit([]string{emptyDB})
+	c.Check(err, chk.ErrorMatches, "Aborting: '.*empty.sqlite' is empty")
+	err = os.Remove(emptyDB)
+	c.Assert(err, chk.IsNil)
+}
+
+// Test that tree entries with null bytes or newlines in their names can't be crafted to look like other entries
+func (s *DioSuite) Test0006_TreeIDDelimiters(c *chk.C) {
+	lastMod := time.Date(2019, time.March, 15, 18, 1, 0, 0, time.UTC)
+	e1 := dbTreeEntry{
+		EntryType:    DATABASE,
+		LastModified: lastMod,
+		LicenceSHA:   "licence",
+		Name:         "a.sqlite",
+		Sha256:       "sha",
+		Size:         1,
+	}
+	e2 := e1
+	e2.Name = "b.sqlite"
+
+	// With plain delimiters, this single entry would produce the same bytes as the two entries above
+	e3 := e1
+	e3.Name = "a.sqlite\x00" + lastMod.Format(time.RFC3339) + "\x001\ndb\x00licence\x00sha\x00b.sqlite"
+	c.Check(createDBTreeID([]dbTreeEntry{e3}), chk.Not(chk.Equals), createDBTreeID([]dbTreeEntry{e1, e2}))
+
+	// Names which only differ by where a newline is should give different IDs too
+	e4 := e1
+	e4.Name = "a\nb.sqlite"
+	e5 := e1
+	e5.Name = "ab\n.sqlite"
+	c.Check(createDBTreeID([]dbTreeEntry{e4}), chk.Not(chk.Equals), createDBTreeID([]dbTreeEntry{e5}))
+}
+
+// Test the "dio commit" command with a timestamp too far in the future (should fail)
+func (s *DioSuite) Test0007_CommitFutureTimestamp(c *chk.C) {
+	commitCmdTimestamp = time.Now().Add(48 * time.Hour).Format(time.RFC3339)
+	err := commit([]string{s.dbName})
+	commitCmdTimestamp = ""
+	c.Check(err, chk.ErrorMatches, ".*more than a day in the future")
+	_, err = os.Stat(filepath.Join(".dio", s.dbName))
+	c.Check(os.IsNotExist(err), chk.Equals, true)
+}
+
+// Test the "dio init" command, using a copy of the test database
+func (s *DioSuite) Test0008_Init(c *chk.C) {
+	_, err := os.Stat(".dio")
+	c.Assert(os.IsNotExist(err), chk.Equals, true)
+	b, err := ioutil.ReadFile(s.dbFile)
+	c.Assert(err, chk.IsNil)
+	initDBName := "init.sqlite"
+	err = ioutil.WriteFile(initDBName, b, 0644)
+	c.Assert(err, chk.IsNil)
+
+	// Start tracking the database
+	initCmdAuthName = "Default test user"
+	err = initDB([]string{initDBName})
+	c.Assert(err, chk.IsNil)
+	meta, err := localFetchMetadata(initDBName, false)
+	c.Assert(err, chk.IsNil)
+	c.Check(meta.ActiveBranch, chk.Equals, "master")
+	c.Assert(meta.Commits, chk.HasLen, 1)
+	head := meta.Branches["master"].Commit
+	c.Check(meta.Commits[head].Message, chk.Equals, "Initial commit")
+	c.Check(meta.Commits[head].Tree.Entries[0].Sha256, chk.Equals,
+		"e8cab91dec32b3990b427b28380e4e052288054f99c4894742f07dee0c924efd")
+	err = verify([]string{initDBName})
+	c.Check(err, chk.IsNil)
+
+	// A second init should fail, unless forced
+	err = initDB([]string{initDBName})
+	c.Check(err, chk.ErrorMatches, ".*already exists.*")
+	initCmdForce = true
+	err = initDB([]string{initDBName})
+	initCmdForce = false
+	c.Check(err, chk.IsNil)
+	initCmdAuthName = ""
+
+	// Clean up, so the commit tests start without any local metadata
+	err = os.RemoveAll(".dio")
+	c.Assert(err, chk.IsNil)
+	err = os.Remove(initDBName)
+	c.Assert(err, chk.IsNil)
+}
+
+// Commit messages which only differ in their line endings or trailing white space should give the same commit ID
+func (s *DioSuite) Test0009_MessageNormalisation(c *chk.C) {
+	c.Check(normaliseMessage("Subject line  \r\n\r\nBody text\t\r\n\r\n"), chk.Equals, "Subject line\n\nBody text")
+	c.Check(normaliseMessage("\nOld Mac\rline endings\n"), chk.Equals, "Old Mac\nline endings")
+	c.Check(normaliseMessage(" \n\t\n"), chk.Equals, "")
+	com := commitEntry{Message: normaliseMessage("Subject line\r\n\r\nBody text \r\n")}
+	other := commitEntry{Message: normaliseMessage("Subject line\n\nBody text")}
+	c.Check(createCommitID(com), chk.Equals, createCommitID(other))
+
+	// The subject is the first line of the message, and is all the short log output shows
+	c.Check(commitSubject(com), chk.Equals, "Subject line")
+	c.Check(commitSubject(commitEntry{Message: "No body"}), chk.Equals, "No body")
+	c.Check(createCommitText(com, nil, false), chk.Matches, "(?s).*      Subject line\n      \n      Body text\n\n$")
+	c.Check(strings.Contains(createCommitText(com, nil, true), "Body text"), chk.Equals, false)
+}
+
 // Test the "dio commit" command
 func (s *DioSuite) Test0010_Commit(c *chk.C) {
 	// Call the commit code
@@ -337,7 +554,433 @@ func (s *DioSuite) Test0020_Commit2(c *chk.C) {
 	//       info displayed in the output here too
 }
 
+func (s *DioSuite) Test0021_CommitAllowEmpty(c *chk.C) {
+	// Save the metadata, so it can be restored afterwards
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+
+	// Committing the unchanged database should fail, unless --allow-empty is given
+	origLicence := commitCmdLicence
+	commitCmdLicence = ""
+	commitCmdMsg = "Nothing changed"
+	err = commit([]string{s.dbName})
+	c.Check(err, chk.ErrorMatches, "Database is unchanged from last commit.*")
+	commitCmdAllowEmpty = true
+	err = commit([]string{s.dbName})
+	commitCmdAllowEmpty = false
+	commitCmdLicence = origLicence
+	commitCmdMsg = ""
+	c.Assert(err, chk.IsNil)
+
+	// The new commit should have the same tree as its parent
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	head := meta.Commits[meta.Branches["master"].Commit]
+	c.Check(head.Message, chk.Equals, "Nothing changed")
+	c.Check(head.Tree.ID, chk.Equals, meta.Commits[head.Parent].Tree.ID)
+
+	// Restore the original metadata
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+}
+
+func (s *DioSuite) Test0022_CommitEditor(c *chk.C) {
+	// Save the metadata, so it can be restored afterwards
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+
+	// Without --message, the editor should be opened on the template, and what's saved used as the message
+	origLicence := commitCmdLicence
+	commitCmdLicence = ""
+	commitCmdAllowEmpty = true
+	editorMsg = "Written in the editor  \n\n# This line is dropped\nSecond paragraph\n"
+	err = commit([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(editorTmpl, "# Database: "+s.dbName+"\n# Branch: master\n"), chk.Equals, true)
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	c.Check(meta.Commits[meta.Branches["master"].Commit].Message, chk.Equals,
+		"Written in the editor\n\nSecond paragraph")
+
+	// The template file from the config file should start the message, and saving an empty message should abort
+	tmplFile := filepath.Join(tempDir, "template.txt")
+	err = ioutil.WriteFile(tmplFile, []byte("Summary of the change\n"), 0644)
+	c.Assert(err, chk.IsNil)
+	viper.Set("user.template", tmplFile)
+	editorMsg = "# Only a comment\n"
+	commitCmdMsg = ""
+	err = commit([]string{s.dbName})
+	viper.Set("user.template", "")
+	c.Check(err, chk.ErrorMatches, "Aborting: the commit message is empty")
+	c.Check(strings.HasPrefix(editorTmpl, "Summary of the change\n"), chk.Equals, true)
+
+	// With --no-edit, the editor shouldn't be opened
+	editorTmpl = ""
+	commitCmdNoEdit = true
+	err = commit([]string{s.dbName})
+	commitCmdMsg = ""
+	commitCmdNoEdit = false
+	commitCmdAllowEmpty = false
+	commitCmdLicence = origLicence
+	editorMsg = ""
+	c.Assert(err, chk.IsNil)
+	c.Check(editorTmpl, chk.Equals, "")
+
+	// Restore the original metadata
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+}
+
+// Tests choosing the editor for commit messages, including settings which are only whitespace
+func (s *DioSuite) Test0023_EditorCommand(c *chk.C) {
+	oldEditor := viper.GetString("user.editor")
+	oldEnv, envSet := os.LookupEnv("EDITOR")
+
+	// The config file setting is used first, split into the command and its arguments
+	viper.Set("user.editor", "code --wait")
+	err := os.Setenv("EDITOR", "nano")
+	c.Assert(err, chk.IsNil)
+	c.Check(editorCommand(), chk.DeepEquals, []string{"code", "--wait"})
+
+	// A blank config file setting is skipped, so the environment variable is used
+	viper.Set("user.editor", "   ")
+	c.Check(editorCommand(), chk.DeepEquals, []string{"nano"})
+
+	// With neither set to anything but whitespace, the default editor is used
+	err = os.Setenv("EDITOR", " \t ")
+	c.Assert(err, chk.IsNil)
+	def := []string{"vi"}
+	if runtime.GOOS == "windows" {
+		def = []string{"notepad"}
+	}
+	c.Check(editorCommand(), chk.DeepEquals, def)
+
+	// Restore the original settings
+	viper.Set("user.editor", oldEditor)
+	if envSet {
+		err = os.Setenv("EDITOR", oldEnv)
+	} else {
+		err = os.Unsetenv("EDITOR")
+	}
+	c.Assert(err, chk.IsNil)
+}
+
+func (s *DioSuite) Test0024_LogLimit(c *chk.C) {
+	// Retrieve only the most recent commit
+	logLimit = 1
+	err := branchLog([]string{s.dbName})
+	logLimit = 0
+	c.Assert(err, chk.IsNil)
+
+	// Only the second commit should be listed
+	lines := bufio.NewScanner(&s.buf)
+	var comCount int
+	for lines.Scan() {
+		l := strings.TrimSpace(lines.Text())
+		if strings.HasPrefix(l, "* Commit:") {
+			comCount++
+			c.Check(strings.TrimSpace(strings.TrimPrefix(l, "* Commit:")), chk.Not(chk.Equals),
+				"59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941")
+		}
+	}
+	c.Check(comCount, chk.Equals, 1)
+
+	// Display the first commit with its ID in short form
+	s.buf.Reset()
+	logShort = true
+	err = branchLog([]string{s.dbName})
+	logShort = false
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "* Commit: 59b72b78cb\n"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "59b72b78cb83"), chk.Equals, false)
+
+	// Only the first commit was made before 18:01:02
+	s.buf.Reset()
+	logUntil = time.Date(2019, time.March, 15, 18, 1, 2, 0, time.UTC).Format(time.RFC3339)
+	err = branchLog([]string{s.dbName})
+	logUntil = ""
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Count(s.buf.String(), "* Commit:"), chk.Equals, 1)
+	c.Check(strings.Contains(s.buf.String(), "59b72b78cb83"), chk.Equals, true)
+
+	// And only the second one was made after it
+	s.buf.Reset()
+	logSince = time.Date(2019, time.March, 15, 18, 1, 2, 0, time.UTC).Format(time.RFC3339)
+	err = branchLog([]string{s.dbName})
+	logSince = ""
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Count(s.buf.String(), "* Commit:"), chk.Equals, 1)
+	c.Check(strings.Contains(s.buf.String(), "59b72b78cb83"), chk.Equals, false)
+}
+
+func (s *DioSuite) Test0025_Revert(c *chk.C) {
+	// Save the metadata and database file, so they can be restored afterwards
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+	origDB, err := ioutil.ReadFile(s.dbName)
+	c.Assert(err, chk.IsNil)
+	fi, err := os.Stat(s.dbName)
+	c.Assert(err, chk.IsNil)
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	oldHead := meta.Branches["master"].Commit
+
+	// Revert to the first commit, which should add a new commit rather than removing the second one
+	firstCommit := "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"
+	err = revert([]string{s.dbName, firstCommit})
+	c.Assert(err, chk.IsNil)
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	newHead := meta.Commits[meta.Branches["master"].Commit]
+	c.Check(newHead.Parent, chk.Equals, oldHead)
+	c.Check(newHead.Tree.ID, chk.Equals, meta.Commits[firstCommit].Tree.ID)
+	c.Check(meta.Branches["master"].CommitCount, chk.Equals, 3)
+	changed, err := dbChanged(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+	c.Check(changed, chk.Equals, false)
+
+	// Reverting to the current head shouldn't be possible
+	err = revert([]string{s.dbName, newHead.ID})
+	c.Check(err, chk.ErrorMatches, ".*Nothing to revert")
+
+	// Restore the original state
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+	err = ioutil.WriteFile(s.dbName, origDB, 0644)
+	c.Assert(err, chk.IsNil)
+	err = os.Chtimes(s.dbName, time.Now(), fi.ModTime())
+	c.Assert(err, chk.IsNil)
+	revertCmdBranch = ""
+	revertCmdMsg = ""
+}
+
+func (s *DioSuite) Test0026_Diff(c *chk.C) {
+	// Compare the first commit with the head of the master branch
+	err := diff([]string{s.dbName, "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941", "master"})
+	c.Assert(err, chk.IsNil)
+
+	// Only the last modified date of the database should have changed
+	lines := bufio.NewScanner(&s.buf)
+	var modFound, lastModFound, contentsFound bool
+	for lines.Scan() {
+		l := strings.TrimSpace(lines.Text())
+		switch {
+		case l == "* Modified: "+s.dbName:
+			modFound = true
+		case strings.HasPrefix(l, "Last modified:"):
+			lastModFound = true
+		case strings.HasPrefix(l, "Contents changed:"):
+			contentsFound = true
+		}
+	}
+	c.Check(modFound, chk.Equals, true)
+	c.Check(lastModFound, chk.Equals, true)
+	c.Check(contentsFound, chk.Equals, false)
+
+	// Unknown commits should be rejected
+	err = diff([]string{s.dbName, "master", "nosuchbranch"})
+	c.Check(err, chk.NotNil)
+
+	// Without any commits given, the database file is compared with the head of the active branch
+	s.buf.Reset()
+	err = diff([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "No differences"), chk.Equals, true)
+
+	// Change the database file, then compare again
+	fi, err := os.Stat(s.dbFile)
+	c.Assert(err, chk.IsNil)
+	origDB, err := ioutil.ReadFile(s.dbFile)
+	c.Assert(err, chk.IsNil)
+	err = ioutil.WriteFile(s.dbFile, append(append([]byte(nil), origDB...), 0), 0644)
+	c.Assert(err, chk.IsNil)
+	s.buf.Reset()
+	err = diff([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "* Modified: "+s.dbName), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "(+1 bytes)"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "Warning"), chk.Equals, false)
+
+	// Files which are no longer SQLite databases should be pointed out
+	err = ioutil.WriteFile(s.dbFile, []byte("not a database"), 0644)
+	c.Assert(err, chk.IsNil)
+	s.buf.Reset()
+	err = diff([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "doesn't seem to be an SQLite database"), chk.Equals, true)
+
+	// Restore the original database file
+	err = ioutil.WriteFile(s.dbFile, origDB, 0644)
+	c.Assert(err, chk.IsNil)
+	err = os.Chtimes(s.dbFile, time.Now(), fi.ModTime())
+	c.Assert(err, chk.IsNil)
+}
+
 // Test the "dio branch" commands
+func (s *DioSuite) Test0027_Squash(c *chk.C) {
+	// Save the metadata, so it can be restored afterwards
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	headID := meta.Branches["master"].Commit
+	head := meta.Commits[headID]
+	base := meta.Commits[head.Parent]
+
+	// Squashing needs --force, as it rewrites history
+	err = squash([]string{s.dbName, base.ID})
+	c.Check(err, chk.ErrorMatches, "Squashing rewrites the history.*--force.*")
+
+	// Squash both commits of the master branch into one
+	squashCmdForce = true
+	err = squash([]string{s.dbName, base.ID})
+	squashCmdBranch = ""
+	squashCmdForce = false
+	squashCmdMsg = ""
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "2 commits on branch 'master' squashed into one"), chk.Equals, true)
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	br := meta.Branches["master"]
+	c.Check(br.CommitCount, chk.Equals, 1)
+	newCom := meta.Commits[br.Commit]
+	c.Check(newCom.Parent, chk.Equals, base.Parent)
+	c.Check(newCom.Tree.ID, chk.Equals, head.Tree.ID)
+	c.Check(newCom.AuthorName, chk.Equals, base.AuthorName)
+	c.Check(newCom.Message, chk.Equals, base.Message+"\n\n"+head.Message)
+	c.Check(newCom.ID, chk.Equals, createCommitID(newCom))
+	c.Check(newCom.AuthorTimestamp.IsZero(), chk.Equals, true)
+	c.Check(newCom.CommitterTimestamp.IsZero(), chk.Equals, true)
+
+	// The squashed commits should be kept, until gc removes them
+	_, ok := meta.Commits[headID]
+	c.Check(ok, chk.Equals, true)
+	_, ok = meta.Commits[base.ID]
+	c.Check(ok, chk.Equals, true)
+
+	// Restore the original metadata
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+}
+
+func (s *DioSuite) Test0028_ReflogReset(c *chk.C) {
+	// Save the metadata and database, so they can be restored afterwards
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+	origDB, err := ioutil.ReadFile(s.dbName)
+	c.Assert(err, chk.IsNil)
+	meta, err := loadMetadata(s.dbName)
+	c.Assert(err, chk.IsNil)
+	headID := meta.Branches["master"].Commit
+
+	// Move the branch head to its parent, back again, then to the parent once more.  Each move should be recorded
+	// along with the command doing it
+	reflogAction = "test move"
+	br := meta.Branches["master"]
+	for _, id := range []string{meta.Commits[headID].Parent, headID, meta.Commits[headID].Parent} {
+		br.Commit = id
+		meta.Branches["master"] = br
+		err = saveMetadata(s.dbName, meta)
+		c.Assert(err, chk.IsNil)
+	}
+	err = reflog([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "* master@{0}: "+br.Commit+"\n    Action: test move\n    Moved from: "+
+		headID+"\n"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "* master@{1}: "+headID+"\n"), chk.Equals, true)
+
+	// Reset back to where the branch was.  The database file no longer matches the head, so --force is needed
+	reflogAction = "reset"
+	resetCmdTo = "master@{1}"
+	err = reset([]string{s.dbName})
+	c.Check(err, chk.ErrorMatches, ".*has been changed since the last commit.*")
+	resetCmdForce = true
+	err = reset([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	meta, err = loadMetadata(s.dbName)
+	c.Assert(err, chk.IsNil)
+	c.Check(meta.Branches["master"].Commit, chk.Equals, headID)
+	b, err := ioutil.ReadFile(s.dbName)
+	c.Assert(err, chk.IsNil)
+	c.Check(bytes.Equal(b, origDB), chk.Equals, true)
+	entries, err := reflogRead(s.dbName, "master")
+	c.Assert(err, chk.IsNil)
+	c.Check(entries[0].Action, chk.Equals, "reset")
+	c.Check(entries[0].NewCommit, chk.Equals, headID)
+
+	// Entries which don't exist, or don't look like reflog entries, should be refused
+	resetCmdTo = "master@{9999}"
+	err = reset([]string{s.dbName})
+	c.Check(err, chk.ErrorMatches, "Branch 'master' only has .* reflog entries")
+	resetCmdTo = "master"
+	err = reset([]string{s.dbName})
+	c.Check(err, chk.ErrorMatches, "'master' isn't a reflog entry.*")
+	resetCmdTo = ""
+	resetCmdForce = false
+	reflogAction = ""
+
+	// Restore the original metadata
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+}
+
+func (s *DioSuite) Test0029_ReflogResetSquash(c *chk.C) {
+	// Save the metadata, so it can be restored afterwards
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+	meta, err := loadMetadata(s.dbName)
+	c.Assert(err, chk.IsNil)
+	headID := meta.Branches["master"].Commit
+	baseID := meta.Commits[headID].Parent
+
+	// Squash the master branch
+	reflogAction = "squash"
+	squashCmdForce = true
+	err = squash([]string{s.dbName, baseID})
+	squashCmdBranch = ""
+	squashCmdForce = false
+	squashCmdMsg = ""
+	c.Assert(err, chk.IsNil)
+
+	// The commits from before the squash are only in the reflog now, so gc shouldn't count them as unreferenced
+	s.buf.Reset()
+	gcCmdPrune = false
+	err = gc([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), headID), chk.Equals, false)
+	c.Check(strings.Contains(s.buf.String(), baseID), chk.Equals, false)
+
+	// Nor should merging in the metadata from the server drop them
+	_, err = updateMetadata(s.dbName, true)
+	c.Assert(err, chk.IsNil)
+	meta, err = loadMetadata(s.dbName)
+	c.Assert(err, chk.IsNil)
+	_, ok := meta.Commits[headID]
+	c.Check(ok, chk.Equals, true)
+
+	// Resetting to the reflog entry from before the squash should undo it
+	reflogAction = "reset"
+	resetCmdTo = "master@{1}"
+	err = reset([]string{s.dbName})
+	resetCmdTo = ""
+	reflogAction = ""
+	c.Assert(err, chk.IsNil)
+	meta, err = loadMetadata(s.dbName)
+	c.Assert(err, chk.IsNil)
+	c.Check(meta.Branches["master"].Commit, chk.Equals, headID)
+	c.Check(meta.Branches["master"].CommitCount, chk.Equals, 2)
+
+	// Restore the original metadata
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+}
+
 func (s *DioSuite) Test0030_BranchActiveGet(c *chk.C) {
 	// Query the active branch
 	err := branchActiveGet([]string{s.dbName})
@@ -411,6 +1054,30 @@ func (s *DioSuite) Test0060_BranchList(c *chk.C) {
 	c.Check(branchTwoFound, chk.Equals, true)
 }
 
+func (s *DioSuite) Test0065_BranchHistory(c *chk.C) {
+	// The history of the requested branch should be displayed, starting with its head commit
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	logBranch = "branchtwo"
+	err = branchLog([]string{s.dbName})
+	logBranch = ""
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "* Commit: "+meta.Branches["branchtwo"].Commit), chk.Equals, true)
+
+	// Listing the branches of a database without any should say so, rather than showing an empty list
+	s.buf.Reset()
+	emptyDB := "nobranches.sqlite"
+	err = os.MkdirAll(filepath.Join(".dio", emptyDB), 0770)
+	c.Assert(err, chk.IsNil)
+	err = ioutil.WriteFile(filepath.Join(".dio", emptyDB, "metadata.json"), []byte("{}"), 0644)
+	c.Assert(err, chk.IsNil)
+	err = branchList([]string{emptyDB})
+	c.Check(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "  No branches found\n"), chk.Equals, true)
+	err = os.RemoveAll(filepath.Join(".dio", emptyDB))
+	c.Assert(err, chk.IsNil)
+}
+
 func (s *DioSuite) Test0070_BranchRemoveFail(c *chk.C) {
 	// Attempt to remove the branch (should fail)
 	branchRemoveBranch = "branchtwo"
@@ -445,6 +1112,79 @@ func (s *DioSuite) Test0080_BranchSetMaster(c *chk.C) {
 	c.Check(strings.TrimSpace(p[1]), chk.Equals, branchActiveSetBranch)
 }
 
+func (s *DioSuite) Test0085_BranchRename(c *chk.C) {
+	// Renaming the default branch, or to a name already in use, should fail
+	branchRenameBranch = "master"
+	branchRenameNewName = "main"
+	err := branchRename([]string{s.dbName})
+	c.Check(err, chk.ErrorMatches, "Can't rename the default branch.*")
+	branchRenameBranch = "branchtwo"
+	branchRenameNewName = "master"
+	err = branchRename([]string{s.dbName})
+	c.Check(err, chk.ErrorMatches, ".*already exists")
+
+	// Rename "branchtwo", then check it's only present under the new name
+	branchRenameNewName = "branchthree"
+	err = branchRename([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	_, ok := meta.Branches["branchtwo"]
+	c.Check(ok, chk.Equals, false)
+	_, ok = meta.Branches["branchthree"]
+	c.Check(ok, chk.Equals, true)
+
+	// Rename it back, for the following tests
+	branchRenameBranch = "branchthree"
+	branchRenameNewName = "branchtwo"
+	err = branchRename([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+}
+
+func (s *DioSuite) Test0087_BranchProtect(c *chk.C) {
+	// Protect the master and "branchtwo" branches
+	branchProtectBranch = "master"
+	err := branchProtect([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	branchProtectBranch = "branchtwo"
+	err = branchProtect([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	err = branchProtect([]string{s.dbName})
+	c.Check(err, chk.ErrorMatches, ".*already protected")
+	s.buf.Reset()
+	err = branchList([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "'master' - Commit: "+
+		"70815d687cfc614b23dfb2f66f8fa0a8cb7bad199e05d4142db883690eefeba5 (protected)"), chk.Equals, true)
+
+	// Reverting or removing a protected branch should fail
+	branchRevertBranch = "master"
+	branchRevertCommit = "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"
+	err = branchRevert([]string{s.dbName})
+	branchRevertBranch = ""
+	branchRevertCommit = ""
+	c.Check(err, chk.ErrorMatches, "Branch 'master' is protected.*")
+	branchRemoveBranch = "branchtwo"
+	err = branchRemove([]string{s.dbName})
+	branchRemoveBranch = ""
+	c.Check(err, chk.ErrorMatches, "Branch 'branchtwo' is protected.*")
+
+	// Remove the protection again, for the following tests
+	branchProtectRemove = true
+	err = branchProtect([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	branchProtectBranch = "master"
+	err = branchProtect([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	err = branchProtect([]string{s.dbName})
+	branchProtectBranch = ""
+	branchProtectRemove = false
+	c.Check(err, chk.ErrorMatches, ".*isn't protected")
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	c.Check(meta.Protected, chk.HasLen, 0)
+}
+
 func (s *DioSuite) Test0090_BranchRemoveSuccess(c *chk.C) {
 	// Attempt to remove the branch (should succeed)
 	branchRemoveBranch = "branchtwo"
@@ -493,25 +1233,119 @@ func (s *DioSuite) Test0100_BranchRevert(c *chk.C) {
 	c.Check(strings.TrimSpace(s.buf.String()), chk.Equals, "Branch reverted")
 }
 
-func (s *DioSuite) Test0110_BranchUpdateChgDesc(c *chk.C) {
-	// Verify that (prior to the update) the master branch has an empty description
-	meta, err := localFetchMetadata(s.dbName, false)
+// Test the "dio checkout" command
+func (s *DioSuite) Test0105_Checkout(c *chk.C) {
+	// Checking out an unknown commit should fail
+	checkoutCmdForce = false
+	err := checkout([]string{s.dbName, "nosuchcommit"})
+	c.Check(err, chk.NotNil)
+
+	// Check out the root commit
+	err = checkout([]string{s.dbName, "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"})
 	c.Assert(err, chk.IsNil)
-	br, ok := meta.Branches["master"]
-	c.Assert(ok, chk.Equals, true)
-	c.Check(br.Description, chk.Equals, "")
 
-	// Update description for the master branch
-	branchUpdateBranch = "master"
-	branchUpdateMsg = "This is a new description"
-	err = branchUpdate([]string{s.dbName})
+	// Verify the database file matches the commit
+	meta, err := localFetchMetadata(s.dbName, false)
 	c.Assert(err, chk.IsNil)
+	com := meta.Commits["59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"]
+	b, err := ioutil.ReadFile(s.dbFile)
+	c.Assert(err, chk.IsNil)
+	z := sha256.Sum256(b)
+	c.Check(hex.EncodeToString(z[:]), chk.Equals, com.Tree.Entries[0].Sha256)
+	changed, err := dbChanged(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+	c.Check(changed, chk.Equals, false)
 
-	// Verify the description was correctly updated
+	// Checking out a branch should make it the active one
+	err = checkout([]string{s.dbName, "master"})
+	c.Assert(err, chk.IsNil)
 	meta, err = localFetchMetadata(s.dbName, false)
 	c.Assert(err, chk.IsNil)
-	br, ok = meta.Branches["master"]
-	c.Assert(ok, chk.Equals, true)
+	c.Check(meta.ActiveBranch, chk.Equals, "master")
+}
+
+func (s *DioSuite) Test0106_CheckoutOlderCommit(c *chk.C) {
+	// Save the metadata and database file, so they can be restored afterwards
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+	origDB, err := ioutil.ReadFile(s.dbFile)
+	c.Assert(err, chk.IsNil)
+	fi, err := os.Stat(s.dbFile)
+	c.Assert(err, chk.IsNil)
+
+	// Add a new commit to master, so the root commit is no longer the head
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	oldHead := meta.Branches["master"].Commit
+	err = ioutil.WriteFile(s.dbFile, append(origDB, make([]byte, 1024)...), 0644)
+	c.Assert(err, chk.IsNil)
+	commitCmdMsg = "A commit to check out from"
+	origLicence := commitCmdLicence
+	commitCmdLicence = ""
+	err = commit([]string{s.dbName})
+	commitCmdMsg = ""
+	commitCmdLicence = origLicence
+	c.Assert(err, chk.IsNil)
+
+	// Check out the previous commit.  The checked out commit should be recorded, and the database file shouldn't
+	// be seen as changed
+	checkoutCmdForce = false
+	err = checkout([]string{s.dbName, oldHead})
+	c.Assert(err, chk.IsNil)
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	c.Check(meta.CheckedOut, chk.Equals, oldHead)
+	changed, err := dbChanged(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+	c.Check(changed, chk.Equals, false)
+	s.buf.Reset()
+	err = status([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "unchanged"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "Commit "+oldHead+" is checked out"), chk.Equals, true)
+
+	// Checking the branch out again shouldn't need --force
+	s.buf.Reset()
+	err = checkout([]string{s.dbName, "master"})
+	c.Assert(err, chk.IsNil)
+	c.Check(s.buf.String(), chk.Equals, "Branch 'master' checked out for '"+s.dbName+"'\n")
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	c.Check(meta.CheckedOut, chk.Equals, "")
+	b, err := ioutil.ReadFile(s.dbFile)
+	c.Assert(err, chk.IsNil)
+	z := sha256.Sum256(b)
+	c.Check(hex.EncodeToString(z[:]), chk.Equals, meta.Commits[meta.Branches["master"].Commit].Tree.Entries[0].Sha256)
+
+	// Restore the original metadata and database file
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+	err = ioutil.WriteFile(s.dbFile, origDB, 0644)
+	c.Assert(err, chk.IsNil)
+	err = os.Chtimes(s.dbFile, time.Now(), fi.ModTime())
+	c.Assert(err, chk.IsNil)
+}
+
+func (s *DioSuite) Test0110_BranchUpdateChgDesc(c *chk.C) {
+	// Verify that (prior to the update) the master branch has an empty description
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	br, ok := meta.Branches["master"]
+	c.Assert(ok, chk.Equals, true)
+	c.Check(br.Description, chk.Equals, "")
+
+	// Update description for the master branch
+	branchUpdateBranch = "master"
+	branchUpdateMsg = "This is a new description"
+	err = branchUpdate([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+
+	// Verify the description was correctly updated
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	br, ok = meta.Branches["master"]
+	c.Assert(ok, chk.Equals, true)
 	c.Check(br.Description, chk.Equals, branchUpdateMsg)
 }
 
@@ -539,6 +1373,146 @@ func (s *DioSuite) Test0120_BranchUpdateDelDesc(c *chk.C) {
 	c.Check(strings.TrimSpace(s.buf.String()), chk.Equals, "Branch updated")
 }
 
+// Test the "dio merge" command
+func (s *DioSuite) Test0125_Merge(c *chk.C) {
+	// Create two branches, each with their own commit on top of the root commit
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	rootID := "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"
+	for i, br := range []string{"master", "mergetest"} {
+		com := meta.Commits[rootID]
+		com.Message = fmt.Sprintf("Commit %d on top of the root", i)
+		com.Parent = rootID
+		com.ID = createCommitID(com)
+		meta.Commits[com.ID] = com
+		meta.Branches[br] = branchEntry{Commit: com.ID, CommitCount: 2}
+	}
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+	masterHead := meta.Branches["master"].Commit
+	mergeHead := meta.Branches["mergetest"].Commit
+
+	// Merging the diverged branches should create a merge commit with both branch heads as parents
+	mergeCmdDest = ""
+	mergeCmdMsg = ""
+	mergeCmdSource = "mergetest"
+	err = merge([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	mergeCom, ok := meta.Commits[meta.Branches["master"].Commit]
+	c.Assert(ok, chk.Equals, true)
+	c.Check(mergeCom.Parent, chk.Equals, masterHead)
+	c.Check(mergeCom.OtherParents, chk.DeepEquals, []string{mergeHead})
+	c.Check(mergeCom.ID, chk.Equals, createCommitID(mergeCom))
+	c.Check(meta.Branches["master"].CommitCount, chk.Equals, 3)
+
+	// Merging master back into the other branch should just fast forward it
+	mergeCmdDest = "mergetest"
+	mergeCmdSource = "master"
+	err = merge([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	c.Check(meta.Branches["mergetest"].Commit, chk.Equals, mergeCom.ID)
+
+	// Restore the original metadata
+	mergeCmdDest = ""
+	mergeCmdSource = ""
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+}
+
+func (s *DioSuite) Test0126_BranchDiff(c *chk.C) {
+	// Create a branch with two commits on top of the root commit, while master has one of its own
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	rootID := "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"
+	var ids []string
+	parent := rootID
+	for i := 0; i < 2; i++ {
+		com := meta.Commits[rootID]
+		com.Message = fmt.Sprintf("Branch diff commit %d", i)
+		com.Parent = parent
+		com.Timestamp = com.Timestamp.Add(time.Duration(i+1) * time.Hour)
+		com.ID = createCommitID(com)
+		meta.Commits[com.ID] = com
+		ids = append(ids, com.ID)
+		parent = com.ID
+	}
+	com := meta.Commits[rootID]
+	com.Message = "Master only commit"
+	com.Parent = rootID
+	com.ID = createCommitID(com)
+	meta.Commits[com.ID] = com
+	meta.Branches["master"] = branchEntry{Commit: com.ID, CommitCount: 2}
+	meta.Branches["difftest"] = branchEntry{Commit: ids[1], CommitCount: 3}
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+
+	// Only the two commits on the branch should be listed, newest first
+	branchDiffBranch = "difftest"
+	err = branchDiff([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	out := s.buf.String()
+	c.Check(strings.HasPrefix(out, "2 commit(s) on branch 'difftest' which aren't on 'master':\n"), chk.Equals, true)
+	c.Check(strings.Contains(out, ids[0]), chk.Equals, true)
+	c.Check(strings.Index(out, ids[1]) < strings.Index(out, ids[0]), chk.Equals, true)
+	c.Check(strings.Contains(out, com.ID+"\n"), chk.Equals, false)
+	c.Check(strings.Contains(out, "The branches split at commit "+rootID+"\n"), chk.Equals, true)
+
+	// The other way around, only the master commit should be listed
+	s.buf.Reset()
+	branchDiffBranch = "master"
+	branchDiffBase = "difftest"
+	err = branchDiff([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.HasPrefix(s.buf.String(), "1 commit(s) on branch 'master' which aren't on 'difftest':\n"),
+		chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), com.ID), chk.Equals, true)
+
+	// Only the --short flag of branch diff itself should shorten the commit IDs, not the one from dio log
+	s.buf.Reset()
+	logShort = true
+	err = branchDiff([]string{s.dbName})
+	logShort = false
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), com.ID), chk.Equals, true)
+	s.buf.Reset()
+	branchDiffShort = true
+	err = branchDiff([]string{s.dbName})
+	branchDiffShort = false
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), com.ID), chk.Equals, false)
+	c.Check(strings.Contains(s.buf.String(), shortID(com.ID)), chk.Equals, true)
+
+	// A branch with nothing new should say so, and comparing a branch with itself should fail
+	s.buf.Reset()
+	branchDiffBranch = ""
+	branchDiffBase = ""
+	meta.Branches["difftest"] = branchEntry{Commit: rootID, CommitCount: 1}
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+	branchDiffBranch = "difftest"
+	err = branchDiff([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(s.buf.String(), chk.Equals, "Branch 'difftest' has no commits which aren't on 'master'\n")
+	branchDiffBranch = "master"
+	err = branchDiff([]string{s.dbName})
+	c.Check(err, chk.NotNil)
+
+	// Restore the original metadata
+	branchDiffBranch = ""
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+}
+
 func (s *DioSuite) Test0130_TagCreate(c *chk.C) {
 	// Check the tag to be created doesn't yet exist
 	tagCreateTag = "testtag1"
@@ -547,13 +1521,18 @@ func (s *DioSuite) Test0130_TagCreate(c *chk.C) {
 	z, ok := meta.Tags[tagCreateTag]
 	c.Assert(ok, chk.Equals, false)
 
-	// Create the tag
-	tagCreateCommit = "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"
+	// Tagging a commit which doesn't exist should fail
+	tagCreateCommit = "0000000000000000000000000000000000000000000000000000000000000000"
 	tagCreateDate = "2019-03-15T18:01:05Z"
 	tagCreateEmail = "sometagger@example.org"
 	tagCreateMsg = "This is a test tag"
 	tagCreateName = "A test tagger"
 	err = tagCreate([]string{s.dbName})
+	c.Assert(err, chk.NotNil)
+
+	// Create the tag
+	tagCreateCommit = "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"
+	err = tagCreate([]string{s.dbName})
 	c.Assert(err, chk.IsNil)
 
 	// Check the tag was created
@@ -691,25 +1670,598 @@ func (s *DioSuite) Test0180_ReleaseRemove(c *chk.C) {
 	c.Check(strings.TrimSpace(p[1]), chk.Equals, releaseCreateRelease)
 }
 
+func (s *DioSuite) Test0188_Show(c *chk.C) {
+	// The head of the active branch should be shown by default, with its files
+	meta, err := loadMetadata(s.dbName)
+	c.Assert(err, chk.IsNil)
+	head := meta.Commits[meta.Branches[meta.ActiveBranch].Commit]
+	err = show([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.HasPrefix(s.buf.String(), "Commit: "+head.ID+"\n"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "* Author: "+head.AuthorName+" <"+head.AuthorEmail+">\n"),
+		chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "* Tree: "+head.Tree.ID+"\n"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "Files:\n  * Name: "+s.dbName+"\n"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "SHA256: "+head.Tree.Entries[0].Sha256+"\n"), chk.Equals, true)
+
+	// The JSON form should be the commit as stored
+	s.buf.Reset()
+	showCmdJSON = true
+	err = show([]string{s.dbName, "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"})
+	showCmdJSON = false
+	c.Assert(err, chk.IsNil)
+	var com commitEntry
+	err = json.Unmarshal(s.buf.Bytes(), &com)
+	c.Assert(err, chk.IsNil)
+	c.Check(com.ID, chk.Equals, "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941")
+	c.Check(com.Parent, chk.Equals, "")
+	c.Check(com.Tree.Entries, chk.HasLen, 1)
+}
+
+func (s *DioSuite) Test0189_Blame(c *chk.C) {
+	// Save the metadata, so it can be restored afterwards
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+
+	// Add a commit which changes the database, then one which only changes the licence
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	changed := meta.Commits[meta.Branches["master"].Commit]
+	changed.Parent = changed.ID
+	changed.ID = "b000000000000000000000000000000000000000000000000000000000000001"
+	changed.Tree.Entries = append([]dbTreeEntry(nil), changed.Tree.Entries...)
+	changed.Tree.Entries[0].Sha256 = "b000000000000000000000000000000000000000000000000000000000000000"
+	meta.Commits[changed.ID] = changed
+	licOnly := changed
+	licOnly.Parent = changed.ID
+	licOnly.ID = "b000000000000000000000000000000000000000000000000000000000000002"
+	licOnly.Tree.Entries = append([]dbTreeEntry(nil), changed.Tree.Entries...)
+	licOnly.Tree.Entries[0].LicenceSHA = "b000000000000000000000000000000000000000000000000000000000000003"
+	meta.Commits[licOnly.ID] = licOnly
+	meta.Branches["master"] = branchEntry{Commit: licOnly.ID}
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+
+	// The commit changing the database should be reported, not the licence change
+	err = blame([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "* Commit: "+changed.ID+"\n"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), licOnly.ID), chk.Equals, false)
+
+	// Files which aren't in the tree should be refused
+	err = blame([]string{s.dbName, "nosuchfile"})
+	c.Check(err, chk.ErrorMatches, "There's no file named 'nosuchfile' in the head commit of branch 'master'")
+
+	// Restore the original metadata
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+}
+
 func (s *DioSuite) Test0190_Log(c *chk.C) {
 	// Retrieve the commit list
 	err := branchLog([]string{s.dbName})
 	c.Assert(err, chk.IsNil)
 
-	// The original commit should be listed
-	lines := bufio.NewScanner(&s.buf)
-	var comFound bool
-	for lines.Scan() {
-		l := strings.TrimSpace(lines.Text())
-		if strings.HasPrefix(l, "*") {
-			p := strings.Split(lines.Text(), ":")
-			if len(p) >= 2 && strings.TrimSpace(p[1]) == "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941" {
-				c.Check(p, chk.HasLen, 2)
-				comFound = true
-			}
-		}
-	}
-	c.Check(comFound, chk.Equals, true)
+	// The original commit should be listed
+	lines := bufio.NewScanner(&s.buf)
+	var comFound bool
+	for lines.Scan() {
+		l := strings.TrimSpace(lines.Text())
+		if strings.HasPrefix(l, "*") {
+			p := strings.Split(lines.Text(), ":")
+			if len(p) >= 2 && strings.TrimSpace(p[1]) == "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941" {
+				c.Check(p, chk.HasLen, 2)
+				comFound = true
+			}
+		}
+	}
+	c.Check(comFound, chk.Equals, true)
+}
+
+func (s *DioSuite) Test0191_LogAll(c *chk.C) {
+	// Save the metadata, so it can be restored afterwards
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+
+	// Add a new branch with a commit on top of the master branch head, then merge it back into master
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	headID := meta.Branches["master"].Commit
+	feature := meta.Commits[headID]
+	feature.ID = "f000000000000000000000000000000000000000000000000000000000000001"
+	feature.Parent = headID
+	feature.Timestamp = feature.Timestamp.Add(time.Hour)
+	meta.Commits[feature.ID] = feature
+	meta.Branches["feature"] = branchEntry{Commit: feature.ID}
+	merged := feature
+	merged.ID = "f000000000000000000000000000000000000000000000000000000000000002"
+	merged.OtherParents = []string{feature.ID}
+	merged.Timestamp = feature.Timestamp.Add(time.Hour)
+	meta.Commits[merged.ID] = merged
+	meta.Branches["master"] = branchEntry{Commit: merged.ID}
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+
+	// Every commit should be shown once, newest first, with the branch heads marked
+	logAll = true
+	logBranch = ""
+	err = branchLog([]string{s.dbName})
+	logAll = false
+	c.Assert(err, chk.IsNil)
+	out := s.buf.String()
+	c.Check(strings.Count(out, "* Commit: "+feature.ID), chk.Equals, 1)
+	c.Check(strings.Count(out, "* Commit: "+headID), chk.Equals, 1)
+	c.Check(strings.Contains(out, "* Commit: "+merged.ID+" (master)\n"), chk.Equals, true)
+	c.Check(strings.Contains(out, "* Commit: "+feature.ID+" (feature)\n"), chk.Equals, true)
+	c.Check(strings.Index(out, merged.ID) < strings.Index(out, feature.ID), chk.Equals, true)
+	c.Check(strings.Index(out, feature.ID) < strings.Index(out, "* Commit: "+headID), chk.Equals, true)
+
+	// A branch name and --all can't be used together
+	logAll = true
+	logBranch = "master"
+	err = branchLog([]string{s.dbName})
+	logAll = false
+	logBranch = ""
+	c.Check(err, chk.ErrorMatches, "Either a branch name or --all can be given.*")
+
+	// Restore the original metadata
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+}
+
+func (s *DioSuite) Test0192_Search(c *chk.C) {
+	// The first commit should be found by its message
+	err := search([]string{s.dbName, "first commit"})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "1 commit(s) in '"+s.dbName+"' match"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "* Commit: 59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"),
+		chk.Equals, true)
+
+	// Case differences only matter when not ignoring them
+	s.buf.Reset()
+	err = search([]string{s.dbName, "FIRST commit"})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "No commits in"), chk.Equals, true)
+	s.buf.Reset()
+	searchCmdIgnoreCase = true
+	err = search([]string{s.dbName, "FIRST commit"})
+	searchCmdIgnoreCase = false
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "1 commit(s)"), chk.Equals, true)
+
+	// The author email should be searched too, and bad patterns rejected
+	s.buf.Reset()
+	err = search([]string{s.dbName, `^testdefault@dbhub\.io$`})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "No commits in"), chk.Equals, false)
+	err = search([]string{s.dbName, "(unclosed"})
+	c.Check(err, chk.ErrorMatches, "Invalid search pattern.*")
+
+	// Commits which aren't on any branch shouldn't be found, and --branch should limit the search to one branch
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	rootID := "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"
+	orphan := meta.Commits[rootID]
+	orphan.Message = "Search test orphan"
+	orphan.Parent = rootID
+	orphan.ID = createCommitID(orphan)
+	meta.Commits[orphan.ID] = orphan
+	other := orphan
+	other.Message = "Search test other branch"
+	other.ID = createCommitID(other)
+	meta.Commits[other.ID] = other
+	meta.Branches["searchtest"] = branchEntry{Commit: other.ID, CommitCount: 2}
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+	s.buf.Reset()
+	err = search([]string{s.dbName, "Search test"})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "1 commit(s)"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), other.ID), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), orphan.ID), chk.Equals, false)
+	s.buf.Reset()
+	searchCmdBranch = "master"
+	err = search([]string{s.dbName, "Search test"})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "No commits in"), chk.Equals, true)
+	searchCmdBranch = "nosuchbranch"
+	err = search([]string{s.dbName, "Search test"})
+	searchCmdBranch = ""
+	c.Check(err, chk.ErrorMatches, "That branch .* doesn't exist")
+
+	// Restore the original metadata
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+}
+
+func (s *DioSuite) Test0193_Import(c *chk.C) {
+	// Create a copy of the repository to import from
+	srcDir := c.MkDir()
+	err := os.MkdirAll(filepath.Join(srcDir, ".dio", s.dbName, "db"), 0770)
+	c.Assert(err, chk.IsNil)
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+	err = ioutil.WriteFile(filepath.Join(srcDir, mdFile), origMD, 0644)
+	c.Assert(err, chk.IsNil)
+	files, err := ioutil.ReadDir(filepath.Join(".dio", s.dbName, "db"))
+	c.Assert(err, chk.IsNil)
+	for _, j := range files {
+		b, err := ioutil.ReadFile(filepath.Join(".dio", s.dbName, "db", j.Name()))
+		c.Assert(err, chk.IsNil)
+		err = ioutil.WriteFile(filepath.Join(srcDir, ".dio", s.dbName, "db", j.Name()), b, 0644)
+		c.Assert(err, chk.IsNil)
+	}
+	meta, err := loadMetadata(s.dbName)
+	c.Assert(err, chk.IsNil)
+	headID := meta.Branches[meta.ActiveBranch].Commit
+
+	// Importing into the same database keeps the commit IDs, as nothing about the commits needs changing
+	importCmdBranch = "imported"
+	err = importDB([]string{s.dbName, srcDir})
+	c.Assert(err, chk.IsNil)
+	meta, err = loadMetadata(s.dbName)
+	c.Assert(err, chk.IsNil)
+	c.Check(meta.Branches["imported"].Commit, chk.Equals, headID)
+	c.Check(strings.Contains(s.buf.String(), "0 commit(s) imported"), chk.Equals, true)
+
+	// The branch exists now, so doing it again should fail
+	err = importDB([]string{s.dbName, srcDir})
+	c.Check(err, chk.ErrorMatches, "A branch named 'imported' already exists")
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+
+	// Importing into a differently named database gives new commit IDs, which should still verify ok
+	newDB := "imported.sqlite"
+	s.buf.Reset()
+	importCmdBranch = ""
+	importCmdFrom = s.dbName
+	err = importDB([]string{newDB, srcDir})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "commit ID(s) changed"), chk.Equals, true)
+	newMeta, err := loadMetadata(newDB)
+	c.Assert(err, chk.IsNil)
+	newHead := newMeta.Branches[meta.ActiveBranch].Commit
+	c.Check(newHead, chk.Not(chk.Equals), headID)
+	c.Check(newMeta.Commits[newHead].Tree.Entries[0].Name, chk.Equals, newDB)
+	err = verify([]string{newDB})
+	c.Check(err, chk.IsNil)
+	err = os.RemoveAll(filepath.Join(".dio", newDB))
+	c.Assert(err, chk.IsNil)
+
+	// Commits which don't match their ID should be refused
+	com := meta.Commits[headID]
+	com.Message = "Changed"
+	meta.Commits[headID] = com
+	b, err := json.Marshal(meta)
+	c.Assert(err, chk.IsNil)
+	err = ioutil.WriteFile(filepath.Join(srcDir, mdFile), b, 0644)
+	c.Assert(err, chk.IsNil)
+	err = importDB([]string{newDB, srcDir})
+	importCmdFrom = ""
+	importCmdSourceBranch = ""
+	c.Check(err, chk.ErrorMatches, "Aborting: commit '"+headID+"' in the source metadata doesn't match.*")
+	_, err = os.Stat(filepath.Join(".dio", newDB))
+	c.Check(os.IsNotExist(err), chk.Equals, true)
+}
+
+func (s *DioSuite) Test0194_LsFiles(c *chk.C) {
+	// The head of the active branch should be used by default
+	meta, err := loadMetadata(s.dbName)
+	c.Assert(err, chk.IsNil)
+	head := meta.Commits[meta.Branches[meta.ActiveBranch].Commit]
+	err = lsFiles([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "Files in commit "+head.ID), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "* Name: "+s.dbName+"\n"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "SHA256: "+head.Tree.Entries[0].Sha256+"\n"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "Type: db\n"), chk.Equals, true)
+
+	// A specific commit can be given too, and unknown ones are rejected
+	s.buf.Reset()
+	err = lsFiles([]string{s.dbName, "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(),
+		"Files in commit 59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"), chk.Equals, true)
+	err = lsFiles([]string{s.dbName, "nosuchcommit"})
+	c.Check(err, chk.ErrorMatches, "'nosuchcommit' isn't a known branch, tag, or commit ID")
+}
+
+// Test the "dio gc" command
+func (s *DioSuite) Test0195_GC(c *chk.C) {
+	// Add a file to the cache which isn't referenced by any commit
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	liveFile := filepath.Join(".dio", s.dbName, "db", meta.Commits[meta.Branches["master"].Commit].Tree.Entries[0].Sha256)
+	orphanFile := filepath.Join(".dio", s.dbName, "db", "0000000000000000000000000000000000000000000000000000000000000000")
+	err = ioutil.WriteFile(orphanFile, []byte("orphaned"), 0644)
+	c.Assert(err, chk.IsNil)
+
+	// And a commit which isn't reachable from anything
+	orphanCom := meta.Commits[meta.Branches["master"].Commit]
+	orphanCom.Message = "Orphaned commit"
+	orphanCom.ID = createCommitID(orphanCom)
+	meta.Commits[orphanCom.ID] = orphanCom
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+
+	// Without --prune, the orphaned file and commit should only be listed
+	gcCmdPrune = false
+	err = gc([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), filepath.Base(orphanFile)), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "commit "+orphanCom.ID), chk.Equals, true)
+	_, err = os.Stat(orphanFile)
+	c.Check(err, chk.IsNil)
+
+	// With --prune, it should be removed while the referenced database stays
+	gcCmdPrune = true
+	err = gc(nil)
+	gcCmdPrune = false
+	c.Assert(err, chk.IsNil)
+	_, err = os.Stat(orphanFile)
+	c.Check(os.IsNotExist(err), chk.Equals, true)
+	_, err = os.Stat(liveFile)
+	c.Check(err, chk.IsNil)
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	_, ok := meta.Commits[orphanCom.ID]
+	c.Check(ok, chk.Equals, false)
+
+	// Save the metadata and reflog, so they can be restored afterwards
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+	logFile := filepath.Join(".dio", s.dbName, "logs", "master")
+	origLog, err := ioutil.ReadFile(logFile)
+	c.Assert(err, chk.IsNil)
+
+	// Move the master branch to a new commit, then move it back again as 'dio reset' would
+	br := meta.Branches["master"]
+	resetCom := meta.Commits[br.Commit]
+	resetCom.Message = "Commit which gets reset away"
+	resetCom.Parent = resetCom.ID
+	resetCom.ID = createCommitID(resetCom)
+	meta.Commits[resetCom.ID] = resetCom
+	meta.Branches["master"] = branchEntry{Commit: resetCom.ID, CommitCount: br.CommitCount + 1}
+	reflogAction = "test move"
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+	reflogAction = "reset"
+	meta.Branches["master"] = br
+	err = saveMetadata(s.dbName, meta)
+	reflogAction = ""
+	c.Assert(err, chk.IsNil)
+
+	// The reflog still mentions the commit, so it shouldn't be pruned yet
+	gcCmdPrune = true
+	err = gc([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	_, ok = meta.Commits[resetCom.ID]
+	c.Check(ok, chk.Equals, true)
+
+	// Once the reflog entries have expired, both they and the commit should be removed
+	gcCmdExpire = 0
+	err = gc([]string{s.dbName})
+	gcCmdExpire = 90
+	gcCmdPrune = false
+	c.Assert(err, chk.IsNil)
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	_, ok = meta.Commits[resetCom.ID]
+	c.Check(ok, chk.Equals, false)
+	ids, err := reflogCommits(s.dbName, time.Time{})
+	c.Assert(err, chk.IsNil)
+	c.Check(ids, chk.HasLen, 0)
+
+	// Restore the original metadata and reflog
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+	err = ioutil.WriteFile(logFile, origLog, 0644)
+	c.Assert(err, chk.IsNil)
+}
+
+func (s *DioSuite) Test0196_SharedCache(c *chk.C) {
+	// Use a shared cache in the temp dir
+	cacheDir = filepath.Join(tempDir, "cache")
+	defer func() { cacheDir = "" }()
+
+	// Move the head database file from the local cache to the shared one
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	headID := meta.Branches["master"].Commit
+	shaSum := meta.Commits[headID].Tree.Entries[0].Sha256
+	localFile := filepath.Join(".dio", s.dbName, "db", shaSum)
+	b, err := ioutil.ReadFile(localFile)
+	c.Assert(err, chk.IsNil)
+	err = cacheStore(shaSum, b)
+	c.Assert(err, chk.IsNil)
+	err = os.Remove(localFile)
+	c.Assert(err, chk.IsNil)
+
+	// The local cache should be refilled from the shared cache, without needing to download anything
+	err = checkDBCache(s.dbName, shaSum, headID)
+	c.Assert(err, chk.IsNil)
+	z, err := ioutil.ReadFile(localFile)
+	c.Assert(err, chk.IsNil)
+	c.Check(z, chk.DeepEquals, b)
+
+	// A corrupted file in the shared cache should be discarded rather than used
+	err = ioutil.WriteFile(filepath.Join(cacheDir, shaSum), []byte("corrupt"), 0644)
+	c.Assert(err, chk.IsNil)
+	_, found, err := cacheRead(shaSum)
+	c.Assert(err, chk.IsNil)
+	c.Check(found, chk.Equals, false)
+	_, err = os.Stat(filepath.Join(cacheDir, shaSum))
+	c.Check(os.IsNotExist(err), chk.Equals, true)
+
+	// Cleaning the shared cache should remove everything in it
+	err = cacheStore(shaSum, b)
+	c.Assert(err, chk.IsNil)
+	err = cacheClean()
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "1 cached file(s) removed"), chk.Equals, true)
+	files, err := ioutil.ReadDir(cacheDir)
+	c.Assert(err, chk.IsNil)
+	c.Check(files, chk.HasLen, 0)
+}
+
+func (s *DioSuite) Test0197_Verify(c *chk.C) {
+	// The local metadata and cache should be fine as they are
+	err := verify([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "No problems found"), chk.Equals, true)
+
+	// Save the metadata, so it can be restored afterwards
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+
+	// Change the message of the head commit and add a corrupt file to the cache, then verify again
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	headID := meta.Branches["master"].Commit
+	com := meta.Commits[headID]
+	com.Message = "Altered message"
+	meta.Commits[headID] = com
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+	badFile := filepath.Join(".dio", s.dbName, "db", "0000000000000000000000000000000000000000000000000000000000000000")
+	err = ioutil.WriteFile(badFile, []byte("corrupt"), 0644)
+	c.Assert(err, chk.IsNil)
+	s.buf.Reset()
+	err = verify([]string{s.dbName})
+	c.Check(err, chk.Not(chk.IsNil))
+	c.Check(strings.Contains(s.buf.String(), "Commit "+headID+": contents have ID"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "Database file "+filepath.Base(badFile)), chk.Equals, true)
+
+	// Commits and tags pointing at commits which don't exist should be reported too
+	meta.Commits[headID] = commitEntry{ID: headID, Parent: "nosuchparent", Tree: com.Tree}
+	meta.Tags["dangling"] = tagEntry{Commit: "nosuchcommit"}
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+	s.buf.Reset()
+	err = verify([]string{s.dbName})
+	c.Check(err, chk.Not(chk.IsNil))
+	c.Check(strings.Contains(s.buf.String(), "Commit "+headID+": parent commit nosuchparent isn't in the commit list"),
+		chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "Tag 'dangling': commit nosuchcommit isn't in the commit list"),
+		chk.Equals, true)
+
+	// Restore the original state
+	err = os.Remove(badFile)
+	c.Assert(err, chk.IsNil)
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+}
+
+// Test the "dio cat" command with each of the object types
+func (s *DioSuite) Test0198_Cat(c *chk.C) {
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	head := meta.Commits[meta.Branches["master"].Commit]
+
+	// Commits are shown as JSON
+	err = cat([]string{s.dbName, head.ID})
+	c.Assert(err, chk.IsNil)
+	var com commitEntry
+	err = json.Unmarshal(s.buf.Bytes(), &com)
+	c.Assert(err, chk.IsNil)
+	c.Check(com.ID, chk.Equals, head.ID)
+
+	// So are trees
+	s.buf.Reset()
+	err = cat([]string{s.dbName, head.Tree.ID})
+	c.Assert(err, chk.IsNil)
+	var t dbTree
+	err = json.Unmarshal(s.buf.Bytes(), &t)
+	c.Assert(err, chk.IsNil)
+	c.Check(t.Entries, chk.HasLen, 1)
+
+	// Database files can be written out
+	outFile := filepath.Join(tempDir, "cat.sqlite")
+	catCmdOutput = outFile
+	err = cat([]string{s.dbName, head.Tree.Entries[0].Sha256})
+	catCmdOutput = ""
+	c.Assert(err, chk.IsNil)
+	b, err := ioutil.ReadFile(outFile)
+	c.Assert(err, chk.IsNil)
+	c.Check(int64(len(b)), chk.Equals, head.Tree.Entries[0].Size)
+	err = os.Remove(outFile)
+	c.Assert(err, chk.IsNil)
+
+	// Unknown IDs should fail
+	err = cat([]string{s.dbName, "0000000000000000000000000000000000000000000000000000000000000000"})
+	c.Check(err, chk.ErrorMatches, "No commit, tree, or database file.*")
+}
+
+func (s *DioSuite) Test0199_Export(c *chk.C) {
+	// Only the git fast-import format is supported
+	exportCmdFormat = "svn"
+	err := export([]string{s.dbName})
+	c.Check(err, chk.ErrorMatches, "Unknown export format 'svn'.*")
+	exportCmdFormat = "git-fast-import"
+
+	// Export the history to a file
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	exportCmdOutput = filepath.Join(tempDir, "export.fi")
+	err = export([]string{s.dbName})
+	exportCmdOutput = ""
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "exported to"), chk.Equals, true)
+	b, err := ioutil.ReadFile(filepath.Join(tempDir, "export.fi"))
+	c.Assert(err, chk.IsNil)
+	stream := string(b)
+
+	// Every commit reachable from the master branch should be in the stream, with its author details
+	head := meta.Commits[meta.Branches["master"].Commit]
+	c.Check(strings.Contains(stream, fmt.Sprintf("author %s <%s> %d +0000\n", head.AuthorName, head.AuthorEmail,
+		commitAuthorTime(head).Unix())), chk.Equals, true)
+	c.Check(strings.Contains(stream, fmt.Sprintf("data %d\n%s\n", len(head.Message), head.Message)), chk.Equals,
+		true)
+	c.Check(strings.Contains(stream, "M 644 :1 "+s.dbName+"\n"), chk.Equals, true)
+	c.Check(strings.Contains(stream, "reset refs/heads/master\nfrom :"), chk.Equals, true)
+	numCommits := 1
+	for z := head; z.Parent != ""; z = meta.Commits[z.Parent] {
+		numCommits++
+	}
+	c.Check(strings.Count(stream, "\ncommit refs/heads/master\n") >= numCommits, chk.Equals, true)
+	err = os.Remove(filepath.Join(tempDir, "export.fi"))
+	c.Assert(err, chk.IsNil)
+
+	// A commit with no committer should use its author as the committer
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+	head.CommitterName = ""
+	head.CommitterEmail = ""
+	head.CommitterTimestamp = time.Time{}
+	meta.Commits[head.ID] = head
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+	exportCmdOutput = filepath.Join(tempDir, "export.fi")
+	err = export([]string{s.dbName})
+	exportCmdOutput = ""
+	c.Assert(err, chk.IsNil)
+	b, err = ioutil.ReadFile(filepath.Join(tempDir, "export.fi"))
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(string(b), fmt.Sprintf("committer %s <%s> %d +0000\n", head.AuthorName,
+		head.AuthorEmail, commitAuthorTime(head).Unix())), chk.Equals, true)
+	c.Check(strings.Contains(string(b), "committer  <>"), chk.Equals, false)
+
+	// Restore the original metadata
+	err = os.Remove(filepath.Join(tempDir, "export.fi"))
+	c.Assert(err, chk.IsNil)
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
 }
 
 func (s *DioSuite) Test0200_StatusUnchanged(c *chk.C) {
@@ -801,6 +2353,66 @@ func (s *DioSuite) Test0210_StatusChanged(c *chk.C) {
 	}
 }
 
+func (s *DioSuite) Test0215_StatusBehind(c *chk.C) {
+	// Mock a remote master branch with one extra commit on top of the local head
+	oldRet := retrieveMetadata
+	retrieveMetadata = func(db string) (metaData, bool, error) {
+		remote, _, err := mockRetrieveMetadata(db)
+		remoteCommit := remote.Commits["59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"]
+		remoteCommit.ID = "a3b6b7c597d8e0c9c8f2d5e4a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2"
+		remoteCommit.Parent = "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"
+		remote.Commits[remoteCommit.ID] = remoteCommit
+		remote.Branches["master"] = branchEntry{Commit: remoteCommit.ID, CommitCount: 2}
+		return remote, true, err
+	}
+
+	// Run the status check command
+	err := status([]string{s.dbName})
+	retrieveMetadata = oldRet
+	c.Assert(err, chk.IsNil)
+
+	// Verify the output
+	lines := bufio.NewScanner(&s.buf)
+	behindFound := false
+	for lines.Scan() {
+		l := strings.TrimSpace(lines.Text())
+		if strings.HasPrefix(l, "Branch 'master' is behind") && strings.HasSuffix(l, "by 1 commit(s)") {
+			behindFound = true
+		}
+	}
+	c.Check(behindFound, chk.Equals, true)
+}
+
+// Tests the status command when the remote server can't be reached, and with --local
+func (s *DioSuite) Test0216_StatusOffline(c *chk.C) {
+	// Mock the server being unreachable
+	oldRet := retrieveMetadata
+	called := false
+	retrieveMetadata = func(db string) (metaData, bool, error) {
+		called = true
+		return metaData{}, false, fmt.Errorf("connection refused")
+	}
+
+	// The local status should still be shown, along with a warning about the remote comparison
+	err := status([]string{s.dbName})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "  * '"+s.dbName+"': "), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "Couldn't compare branch 'master' with "+cloud+": connection refused"),
+		chk.Equals, true)
+
+	// With --local, the server shouldn't be contacted at all
+	s.buf.Reset()
+	called = false
+	statusCmdLocal = true
+	err = status([]string{s.dbName})
+	statusCmdLocal = false
+	retrieveMetadata = oldRet
+	c.Assert(err, chk.IsNil)
+	c.Check(called, chk.Equals, false)
+	c.Check(strings.Contains(s.buf.String(), "  * '"+s.dbName+"': "), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "Couldn't compare"), chk.Equals, false)
+}
+
 func (s *DioSuite) Test0220_LicenceList(c *chk.C) {
 	// Retrieve the licence list
 	err := licenceList()
@@ -949,6 +2561,279 @@ func (s *DioSuite) Test0260_PullLocal(c *chk.C) {
 	c.Check(newSHASum, chk.Equals, origSHASum)
 }
 
+// Tests pulling a branch whose local history has diverged from the remote branch (should fail)
+func (s *DioSuite) Test0265_PullDiverged(c *chk.C) {
+	// Add a local commit to the master branch, which the remote branch doesn't have
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	localCommit := meta.Commits["59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"]
+	localCommit.ID = "b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5"
+	localCommit.Parent = "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"
+	meta.Commits[localCommit.ID] = localCommit
+	meta.Branches["master"] = branchEntry{Commit: localCommit.ID, CommitCount: 2}
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+
+	// Mock a remote master branch with a different commit on top of the root commit
+	oldRet := retrieveMetadata
+	retrieveMetadata = func(db string) (metaData, bool, error) {
+		remote, _, err := mockRetrieveMetadata(db)
+		remoteCommit := remote.Commits["59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"]
+		remoteCommit.ID = "a3b6b7c597d8e0c9c8f2d5e4a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2"
+		remoteCommit.Parent = "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"
+		remote.Commits[remoteCommit.ID] = remoteCommit
+		remote.Branches["master"] = branchEntry{Commit: remoteCommit.ID, CommitCount: 2}
+		return remote, true, err
+	}
+
+	// The pull should be refused
+	pullCmdBranch = "master"
+	pullCmdCommit = ""
+	*pullForce = false
+	err = pull([]string{s.dbName})
+	c.Check(err, chk.ErrorMatches, "Local branch 'master' has diverged .*")
+	c.Check(strings.Contains(s.buf.String(), "* Local head: "+localCommit.ID), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "* Remote head: "+
+		"a3b6b7c597d8e0c9c8f2d5e4a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "* Common ancestor: "+
+		"59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"), chk.Equals, true)
+
+	// The error for conflicting options should name the ones given
+	pullCmdMerge = true
+	*pullForce = true
+	_, err = pullCheckDivergence(s.dbName)
+	*pullForce = false
+	pullCmdMerge = false
+	c.Check(err, chk.ErrorMatches, "Either --merge or --force can be used.  Not both!")
+
+	// A protected branch shouldn't have its local commits thrown away
+	meta.Protected = append(meta.Protected, "master")
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+	pullCmdReset = true
+	_, err = pullCheckDivergence(s.dbName)
+	pullCmdReset = false
+	c.Check(err, chk.ErrorMatches, "Branch 'master' is protected, so its local commits can't be discarded.*")
+	meta.Protected = meta.Protected[:len(meta.Protected)-1]
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+
+	// With --merge, a merge commit joining both heads should be created
+	pullCmdMerge = true
+	_, err = pullCheckDivergence(s.dbName)
+	pullCmdMerge = false
+	c.Assert(err, chk.IsNil)
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	mergeCom := meta.Commits[meta.Branches["master"].Commit]
+	c.Check(mergeCom.Parent, chk.Equals, localCommit.ID)
+	c.Check(mergeCom.OtherParents, chk.DeepEquals,
+		[]string{"a3b6b7c597d8e0c9c8f2d5e4a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2"})
+	_, ok := meta.Commits["a3b6b7c597d8e0c9c8f2d5e4a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2"]
+	c.Check(ok, chk.Equals, true)
+
+	// With --reset, the local commit should be replaced by the remote one
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	meta.Commits[localCommit.ID] = localCommit
+	meta.Branches["master"] = branchEntry{Commit: localCommit.ID, CommitCount: 2}
+	err = saveMetadata(s.dbName, meta)
+	c.Assert(err, chk.IsNil)
+	pullCmdReset = true
+	_, err = pullCheckDivergence(s.dbName)
+	pullCmdReset = false
+	c.Assert(err, chk.IsNil)
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	c.Check(meta.Branches["master"].Commit, chk.Equals,
+		"a3b6b7c597d8e0c9c8f2d5e4a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2")
+
+	// Restore the original metadata and mocked function
+	retrieveMetadata = oldRet
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+}
+
+// Tests that merge commits keep their other parents when metadata is merged, for both a local only branch and a
+// new remote branch
+func (s *DioSuite) Test0266_MergeMetadataOtherParents(c *chk.C) {
+	// Create a merge commit for each of a local only branch and a new remote branch, each merging in a commit which
+	// isn't on the first parent chain
+	root := commitEntry{Message: "Root", Timestamp: time.Date(2019, time.March, 15, 18, 1, 0, 0, time.UTC)}
+	root.ID = createCommitID(root)
+	newMerge := func(name string) (side, merged commitEntry) {
+		side = root
+		side.Message = "Side commit for " + name
+		side.Parent = root.ID
+		side.ID = createCommitID(side)
+		merged = root
+		merged.Message = "Merge commit for " + name
+		merged.Parent = root.ID
+		merged.OtherParents = []string{side.ID}
+		merged.ID = createCommitID(merged)
+		return
+	}
+	localSide, localMerge := newMerge("local")
+	remoteSide, remoteMerge := newMerge("remote")
+	origMeta := metaData{
+		Branches: map[string]branchEntry{
+			"master":     {Commit: root.ID, CommitCount: 1},
+			"localmerge": {Commit: localMerge.ID, CommitCount: 2},
+		},
+		Commits: map[string]commitEntry{root.ID: root, localSide.ID: localSide, localMerge.ID: localMerge},
+	}
+	newMeta := metaData{
+		Branches: map[string]branchEntry{
+			"master":      {Commit: root.ID, CommitCount: 1},
+			"remotemerge": {Commit: remoteMerge.ID, CommitCount: 2},
+		},
+		Commits:   map[string]commitEntry{root.ID: root, remoteSide.ID: remoteSide, remoteMerge.ID: remoteMerge},
+		DefBranch: "master",
+	}
+
+	// The merged commits in both branches should keep their other parents
+	merged, err := mergeMetadata(origMeta, newMeta)
+	c.Assert(err, chk.IsNil)
+	for _, id := range []string{root.ID, localSide.ID, localMerge.ID, remoteSide.ID, remoteMerge.ID} {
+		_, ok := merged.Commits[id]
+		c.Check(ok, chk.Equals, true)
+	}
+	c.Check(isAncestor(merged, localSide.ID, localMerge.ID), chk.Equals, true)
+	c.Check(isAncestor(merged, remoteSide.ID, remoteMerge.ID), chk.Equals, true)
+}
+
+// Tests pulling a diverged branch with --merge and with --reset, all the way through to the database file
+func (s *DioSuite) Test0267_PullDivergedResolve(c *chk.C) {
+	// Save the original metadata and database file, so they can be restored afterwards
+	mdFile := filepath.Join(".dio", s.dbName, "metadata.json")
+	origMD, err := ioutil.ReadFile(mdFile)
+	c.Assert(err, chk.IsNil)
+	origDB, err := ioutil.ReadFile(s.dbFile)
+	c.Assert(err, chk.IsNil)
+	fi, err := os.Stat(s.dbFile)
+	c.Assert(err, chk.IsNil)
+	origMod := fi.ModTime()
+
+	// Put the database for the remote commit in the local cache, so pull doesn't need to download it
+	remoteDB := append(append([]byte{}, origDB...), []byte("remote changes")...)
+	z := sha256.Sum256(remoteDB)
+	remoteSHA := hex.EncodeToString(z[:])
+	remoteCache := filepath.Join(".dio", s.dbName, "db", remoteSHA)
+	err = ioutil.WriteFile(remoteCache, remoteDB, 0644)
+	c.Assert(err, chk.IsNil)
+
+	// Mock a remote master branch with a different commit on top of the root commit, changing the database
+	rootID := "59b72b78cb83bdba371438cb36950fe007265445a63068ae5586c9cc19203941"
+	remoteID := "a3b6b7c597d8e0c9c8f2d5e4a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2"
+	remoteMod := time.Date(2019, time.March, 16, 9, 30, 0, 0, time.UTC)
+	oldRet := retrieveMetadata
+	retrieveMetadata = func(db string) (metaData, bool, error) {
+		remote, _, err := mockRetrieveMetadata(db)
+		remoteCommit := remote.Commits[rootID]
+		remoteCommit.ID = remoteID
+		remoteCommit.Parent = rootID
+		remoteCommit.Tree = dbTree{ID: "c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b2c3d4",
+			Entries: []dbTreeEntry{remoteCommit.Tree.Entries[0]}}
+		remoteCommit.Tree.Entries[0].Sha256 = remoteSHA
+		remoteCommit.Tree.Entries[0].Size = int64(len(remoteDB))
+		remoteCommit.Tree.Entries[0].LastModified = remoteMod
+		remote.Commits[remoteID] = remoteCommit
+		remote.Branches["master"] = branchEntry{Commit: remoteID, CommitCount: 2}
+		return remote, true, err
+	}
+
+	// Adds a local commit to the master branch, which the remote branch doesn't have
+	localID := "b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5"
+	addLocalCommit := func() {
+		err := ioutil.WriteFile(mdFile, origMD, 0644)
+		c.Assert(err, chk.IsNil)
+		meta, err := localFetchMetadata(s.dbName, false)
+		c.Assert(err, chk.IsNil)
+		localCommit := meta.Commits[rootID]
+		localCommit.ID = localID
+		localCommit.Parent = rootID
+		meta.Commits[localID] = localCommit
+		meta.Branches["master"] = branchEntry{Commit: localID, CommitCount: 2}
+		err = saveMetadata(s.dbName, meta)
+		c.Assert(err, chk.IsNil)
+		err = ioutil.WriteFile(s.dbFile, origDB, 0644)
+		c.Assert(err, chk.IsNil)
+		err = os.Chtimes(s.dbFile, time.Now(), origMod)
+		c.Assert(err, chk.IsNil)
+	}
+	pullCmdBranch = "master"
+	pullCmdCommit = ""
+	*pullForce = false
+
+	// If the database file has changes, the branch shouldn't be touched
+	addLocalCommit()
+	err = ioutil.WriteFile(s.dbFile, append(append([]byte{}, origDB...), []byte("unsaved")...), 0644)
+	c.Assert(err, chk.IsNil)
+	pullCmdMerge = true
+	err = pull([]string{s.dbName})
+	c.Check(err, chk.ErrorMatches, ".* has been changed since the last commit.*")
+	meta, err := localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	c.Check(meta.Branches["master"].Commit, chk.Equals, localID)
+
+	// With --merge, the branch head should be a merge commit, and the database file should hold its database
+	addLocalCommit()
+	pullCmdBranch = "master"
+	err = pull([]string{s.dbName})
+	pullCmdMerge = false
+	c.Assert(err, chk.IsNil)
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	mergeCom, ok := meta.Commits[meta.Branches["master"].Commit]
+	c.Assert(ok, chk.Equals, true)
+	c.Check(mergeCom.Parent, chk.Equals, localID)
+	c.Check(mergeCom.OtherParents, chk.DeepEquals, []string{remoteID})
+	c.Check(mergeCom.Tree.Entries[0].Sha256, chk.Equals, remoteSHA)
+	c.Check(meta.Branches["master"].CommitCount, chk.Equals, 3)
+	c.Check(meta.ActiveBranch, chk.Equals, "master")
+	b, err := ioutil.ReadFile(s.dbFile)
+	c.Assert(err, chk.IsNil)
+	c.Check(b, chk.DeepEquals, remoteDB)
+	changed, err := dbChanged(s.dbFile, meta)
+	c.Assert(err, chk.IsNil)
+	c.Check(changed, chk.Equals, false)
+
+	// With --reset, the branch head should be the remote one, and the database file should hold its database
+	addLocalCommit()
+	pullCmdBranch = "master"
+	pullCmdReset = true
+	err = pull([]string{s.dbName})
+	pullCmdReset = false
+	c.Assert(err, chk.IsNil)
+	meta, err = localFetchMetadata(s.dbName, false)
+	c.Assert(err, chk.IsNil)
+	c.Check(meta.Branches["master"], chk.DeepEquals, branchEntry{Commit: remoteID, CommitCount: 2})
+	c.Check(meta.CheckedOut, chk.Equals, "")
+	b, err = ioutil.ReadFile(s.dbFile)
+	c.Assert(err, chk.IsNil)
+	c.Check(b, chk.DeepEquals, remoteDB)
+	changed, err = dbChanged(s.dbFile, meta)
+	c.Assert(err, chk.IsNil)
+	c.Check(changed, chk.Equals, false)
+
+	// Restore the original metadata, database file, and mocked function
+	retrieveMetadata = oldRet
+	pullCmdBranch = ""
+	err = os.Remove(remoteCache)
+	c.Assert(err, chk.IsNil)
+	err = ioutil.WriteFile(mdFile, origMD, 0644)
+	c.Assert(err, chk.IsNil)
+	err = ioutil.WriteFile(s.dbFile, origDB, 0644)
+	c.Assert(err, chk.IsNil)
+	err = os.Chtimes(s.dbFile, time.Now(), origMod)
+	c.Assert(err, chk.IsNil)
+}
+
 // Tests pushing a database with no local commit data, and which doesn't yet exist on the remote server (should succeed)
 func (s *DioSuite) Test0270_PushCompletelyNewDB(c *chk.C) {
 	// Make sure the new database isn't yet shown on the remote server
@@ -980,9 +2865,38 @@ func (s *DioSuite) Test0270_PushCompletelyNewDB(c *chk.C) {
 	pushCmdMsg = "Test message"
 	pushCmdPublic = false
 	pushCmdTimestamp = time.Date(2019, time.March, 15, 18, 30, 0, 0, time.UTC).Format(time.RFC3339)
+
+	// A dry run should report the commit ID the server will generate, without uploading anything
+	pushCmdDryRun = true
+	err = push([]string{newDB})
+	pushCmdDryRun = false
+	c.Assert(err, chk.IsNil)
+	dryRunNonce := pushNonce
+	var expectedID string
+	lines := bufio.NewScanner(&s.buf)
+	for lines.Scan() {
+		l := strings.TrimSpace(lines.Text())
+		if strings.HasPrefix(l, "Expected commit ID:") {
+			expectedID = strings.TrimSpace(strings.TrimPrefix(l, "Expected commit ID:"))
+		}
+	}
+	dbList, err = getDatabases(cloud, "default")
+	c.Assert(err, chk.IsNil)
+	for _, j := range dbList {
+		c.Assert(j.Name, chk.Not(chk.Equals), newDB)
+	}
+
+	// Send the test database to the server for real
 	err = push([]string{newDB})
 	c.Assert(err, chk.IsNil)
 
+	// The upload should have been sent with a key derived from its details, so retries of it can be recognised.
+	// Each run of push picks a new nonce for it though, so pushing the same thing again isn't taken as a retry
+	c.Check(pushNonce, chk.Not(chk.Equals), dryRunNonce)
+	c.Check(lastIdemKey, chk.Equals, pushIdempotencyKey("master", "",
+		"e8cab91dec32b3990b427b28380e4e052288054f99c4894742f07dee0c924efd", "Test message", "testdefault@dbhub.io",
+		"Default test user", pushCmdTimestamp))
+
 	// Verify the new test database is on the server
 	dbList, err = getDatabases(cloud, "default")
 	c.Assert(err, chk.IsNil)
@@ -990,11 +2904,172 @@ func (s *DioSuite) Test0270_PushCompletelyNewDB(c *chk.C) {
 	for _, j := range dbList {
 		if j.Name == newDB {
 			dbFound = true
+			c.Check(j.CommitID, chk.Equals, expectedID)
 		}
 	}
 	c.Assert(dbFound, chk.Equals, true)
 }
 
+// Test the "dio list" command, in both of its output formats
+func (s *DioSuite) Test0273_List(c *chk.C) {
+	newDB := "19kBv2.sqlite"
+	err := list(nil)
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "* Database: "+newDB), chk.Equals, true)
+
+	// The JSON output should be the same list of databases
+	s.buf.Reset()
+	listCmdJSON = true
+	err = list(nil)
+	listCmdJSON = false
+	c.Assert(err, chk.IsNil)
+	var dbList []dbListEntry
+	err = json.Unmarshal(s.buf.Bytes(), &dbList)
+	c.Assert(err, chk.IsNil)
+	dbFound := false
+	for _, j := range dbList {
+		if j.Name == newDB {
+			dbFound = true
+		}
+	}
+	c.Check(dbFound, chk.Equals, true)
+
+	// Filtering by name should only leave the matching databases
+	s.buf.Reset()
+	listCmdJSON = true
+	listCmdPrefix = "19kB"
+	listCmdContains = "v2"
+	err = list(nil)
+	listCmdJSON = false
+	listCmdPrefix = ""
+	listCmdContains = ""
+	c.Assert(err, chk.IsNil)
+	dbList = nil
+	err = json.Unmarshal(s.buf.Bytes(), &dbList)
+	c.Assert(err, chk.IsNil)
+	c.Assert(dbList, chk.HasLen, 1)
+	c.Check(dbList[0].Name, chk.Equals, newDB)
+}
+
+func (s *DioSuite) Test0274_Describe(c *chk.C) {
+	// Set a description containing control characters, which should be stripped out
+	db := mockDBEntries[0].Name
+	err := describe([]string{db, "Test\x07 database\nfor describing\x1b"})
+	c.Assert(err, chk.IsNil)
+	c.Check(mockDBEntries[0].Description, chk.Equals, "Test database\nfor describing")
+
+	// The description should be displayed when asked for
+	s.buf.Reset()
+	err = describe([]string{db})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "Test database\nfor describing\n"), chk.Equals, true)
+
+	// Over long descriptions should be refused, as should unknown databases
+	err = describe([]string{db, strings.Repeat("x", maxDescriptionLen+1)})
+	c.Check(err, chk.ErrorMatches, "The description is too long.*")
+	c.Check(mockDBEntries[0].Description, chk.Equals, "Test database\nfor describing")
+	err = describe([]string{"nosuchdb.sqlite", "foo"})
+	c.Check(err, chk.ErrorMatches, "Database 'nosuchdb.sqlite' wasn't found.*")
+
+	// Remove the description again
+	err = describe([]string{db, ""})
+	c.Assert(err, chk.IsNil)
+	c.Check(mockDBEntries[0].Description, chk.Equals, "")
+	s.buf.Reset()
+	err = describe([]string{db})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "has no description"), chk.Equals, true)
+}
+
+func (s *DioSuite) Test0275_ServerOverride(c *chk.C) {
+	// With nothing else set, the address in the config file should be used
+	origCloud := cloud
+	c.Check(cloudAddress(), chk.Equals, viper.GetString("general.cloud"))
+
+	// The DIO_SERVER environment variable should override the config file
+	err := os.Setenv("DIO_SERVER", "https://env.example.org")
+	c.Assert(err, chk.IsNil)
+	c.Check(cloudAddress(), chk.Equals, "https://env.example.org")
+
+	// And the command line option should override both
+	f := RootCmd.PersistentFlags().Lookup("server")
+	err = f.Value.Set("https://flag.example.org")
+	c.Assert(err, chk.IsNil)
+	f.Changed = true
+	c.Check(cloudAddress(), chk.Equals, "https://flag.example.org")
+
+	// Put things back how they were
+	f.Changed = false
+	cloud = origCloud
+	err = os.Unsetenv("DIO_SERVER")
+	c.Assert(err, chk.IsNil)
+}
+
+func (s *DioSuite) Test0276_Timeout(c *chk.C) {
+	// A request which can't finish within the timeout should say so, rather than giving a generic network error
+	origTimeout := timeout
+	timeout = time.Nanosecond
+	err := list(nil)
+	timeout = origTimeout
+	c.Check(err, chk.ErrorMatches, "No response from .* within 1ns.*--timeout.*")
+}
+
+func (s *DioSuite) Test0277_Token(c *chk.C) {
+	// No Authorization header should be sent unless an API token was given
+	err := list(nil)
+	c.Assert(err, chk.IsNil)
+	c.Check(lastAuth, chk.Equals, "")
+	apiToken = "s3cr3t"
+	err = list(nil)
+	apiToken = ""
+	c.Assert(err, chk.IsNil)
+	c.Check(lastAuth, chk.Equals, "Bearer s3cr3t")
+}
+
+func (s *DioSuite) Test0278_Whoami(c *chk.C) {
+	// The local details come from the client certificate and config file
+	whoamiCmdLocal = true
+	err := whoami()
+	whoamiCmdLocal = false
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "* Username: default\n"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "* Commit author: Some One <"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "Identity on"), chk.Equals, false)
+
+	// The server's view should be shown too, when asked for
+	s.buf.Reset()
+	err = whoami()
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(s.buf.String(), "* Name: Default test user\n"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "* Email: testdefault@dbhub.io\n"), chk.Equals, true)
+	c.Check(strings.Contains(s.buf.String(), "Warning"), chk.Equals, false)
+}
+
+func (s *DioSuite) Test0279_Verbose(c *chk.C) {
+	// With --verbose, the HTTP exchange should be logged, without giving away the API token
+	var debugBuf bytes.Buffer
+	debugOut = &debugBuf
+	verbose = true
+	apiToken = "s3cr3t"
+	err := list(nil)
+	verbose = false
+	apiToken = ""
+	debugOut = os.Stderr
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Contains(debugBuf.String(), "GET /default HTTP/1.1"), chk.Equals, true)
+	c.Check(strings.Contains(debugBuf.String(), "Authorization: [redacted]"), chk.Equals, true)
+	c.Check(strings.Contains(debugBuf.String(), "HTTP/1.1 200 OK"), chk.Equals, true)
+	c.Check(strings.Contains(debugBuf.String(), "s3cr3t"), chk.Equals, false)
+
+	// Without it, nothing should be logged
+	debugBuf.Reset()
+	debugOut = &debugBuf
+	err = list(nil)
+	debugOut = os.Stderr
+	c.Assert(err, chk.IsNil)
+	c.Check(debugBuf.Len(), chk.Equals, 0)
+}
+
 func (s *DioSuite) Test0280_PullRemote(c *chk.C) {
 	// Calculate the SHA256 of the test database
 	newDB := "19kBv2.sqlite"
@@ -1060,6 +3135,118 @@ func (s *DioSuite) Test0290_PushExistingDBConflict(c *chk.C) {
 	c.Check(err, chk.Not(chk.IsNil))
 }
 
+// Tests choosing the error for uploads rejected by the server
+func (s *DioSuite) Test0291_PushRejected(c *chk.C) {
+	// A 403 is only reported as a protected branch when the server says that's the reason
+	pushCmdBranch = ""
+	err := pushRejected(&http.Response{StatusCode: http.StatusForbidden}, "Branch is protected")
+	c.Check(err, chk.ErrorMatches, "The default branch is protected.*")
+	pushCmdBranch = "master"
+	err = pushRejected(&http.Response{StatusCode: http.StatusForbidden}, "Branch is protected")
+	c.Check(err, chk.ErrorMatches, "The branch 'master' is protected.*")
+	err = pushRejected(&http.Response{StatusCode: http.StatusForbidden}, "Invalid API key")
+	c.Check(err, chk.IsNil)
+
+	// As is a 409 for an unchanged database, as the server also uses it for other conflicts
+	err = pushRejected(&http.Response{StatusCode: http.StatusConflict}, "No changes to commit")
+	c.Check(err, chk.ErrorMatches, "The database is unchanged from the head of the branch 'master'.*")
+	err = pushRejected(&http.Response{StatusCode: http.StatusConflict}, "The branch history has diverged")
+	c.Check(err, chk.IsNil)
+
+	// Successful uploads and other errors are left to the caller
+	err = pushRejected(&http.Response{StatusCode: http.StatusCreated}, "")
+	c.Check(err, chk.IsNil)
+	err = pushRejected(&http.Response{StatusCode: http.StatusInternalServerError}, "")
+	c.Check(err, chk.IsNil)
+	err = pushRejected(nil, "")
+	c.Check(err, chk.IsNil)
+	pushCmdBranch = ""
+}
+
+func (s *DioSuite) Test0295_Clone(c *chk.C) {
+	// Calculate the SHA256 of the database on the test server
+	newDB := "19kBv2.sqlite"
+	b, err := ioutil.ReadFile(newDB + "-renamed")
+	c.Assert(err, chk.IsNil)
+	z := sha256.Sum256(b)
+	origSHASum := hex.EncodeToString(z[:])
+
+	// Cloning should refuse to overwrite an existing database file
+	err = clone([]string{newDB})
+	c.Check(err, chk.Not(chk.IsNil))
+
+	// Remove the local copy of the database, then clone it from our test server
+	err = os.Remove(newDB)
+	c.Assert(err, chk.IsNil)
+	cloneCmdBranch = ""
+	err = clone([]string{newDB})
+	c.Assert(err, chk.IsNil)
+
+	// Verify the SHA256 of the cloned database matches
+	b, err = ioutil.ReadFile(newDB)
+	c.Assert(err, chk.IsNil)
+	z = sha256.Sum256(b)
+	newSHASum := hex.EncodeToString(z[:])
+	c.Check(newSHASum, chk.Equals, origSHASum)
+
+	// Verify the local metadata was created, with the default branch active
+	meta, err := localFetchMetadata(newDB, false)
+	c.Assert(err, chk.IsNil)
+	c.Check(meta.ActiveBranch, chk.Equals, "master")
+	c.Check(meta.Branches["master"].Commit, chk.Equals, mockMetaData[newDB].Branches["master"].Commit)
+	_, err = os.Stat(filepath.Join(".dio", newDB, "db", newSHASum))
+	c.Check(err, chk.IsNil)
+
+	// Cloning again should fail, as local metadata now exists
+	err = clone([]string{newDB})
+	c.Check(err, chk.Not(chk.IsNil))
+
+	// Cloning to standard output should only give the database itself
+	s.buf.Reset()
+	cloneCmdOutput = "-"
+	err = clone([]string{newDB})
+	c.Assert(err, chk.IsNil)
+	z = sha256.Sum256(s.buf.Bytes())
+	c.Check(hex.EncodeToString(z[:]), chk.Equals, origSHASum)
+
+	// Cloning into another directory should put the metadata there too
+	outDir := filepath.Join(tempDir, "cloneDir")
+	err = os.Mkdir(outDir, 0750)
+	c.Assert(err, chk.IsNil)
+	cloneCmdOutput = outDir
+	err = clone([]string{newDB})
+	c.Assert(err, chk.IsNil)
+	_, err = os.Stat(filepath.Join(outDir, newDB))
+	c.Check(err, chk.IsNil)
+	_, err = os.Stat(filepath.Join(outDir, ".dio", newDB, "db", newSHASum))
+	c.Check(err, chk.IsNil)
+
+	// Doing it again needs --force
+	err = clone([]string{newDB})
+	c.Check(err, chk.ErrorMatches, ".*--force.*")
+	cloneCmdForce = true
+	err = clone([]string{newDB})
+	c.Check(err, chk.IsNil)
+
+	// The reflog should be kept when the metadata is replaced, with the new clone added to it
+	b, err = ioutil.ReadFile(filepath.Join(outDir, ".dio", newDB, "logs", "master"))
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.Count(string(b), "\n"), chk.Equals, 2)
+
+	// Saving under a different name shouldn't create any metadata for it
+	cloneCmdOutput = filepath.Join(outDir, "renamed.sqlite")
+	err = clone([]string{newDB})
+	c.Assert(err, chk.IsNil)
+	_, err = os.Stat(cloneCmdOutput)
+	c.Check(err, chk.IsNil)
+	_, err = os.Stat(filepath.Join(outDir, ".dio", "renamed.sqlite"))
+	c.Check(os.IsNotExist(err), chk.Equals, true)
+	cloneCmdForce = false
+	cloneCmdOutput = ""
+	err = os.RemoveAll(outDir)
+	c.Assert(err, chk.IsNil)
+}
+
 // Tests pushing a database with local commit data, which doesn't yet exist on the remote server (should succeed)
 func (s *DioSuite) Test0300_PushNewLocalDBAndMetadata(c *chk.C) {
 	// Rename the test database to "19kBv3.sqlite"
@@ -1170,11 +3357,56 @@ func (s *DioSuite) Test0320_PushOldLocalMetadataDBConflict(c *chk.C) {
 	c.Check(err, chk.Not(chk.IsNil))
 }
 
+// Tests pushing several databases at once, where none of them exist (should fail for each one, then report both)
+func (s *DioSuite) Test0325_PushMultiple(c *chk.C) {
+	pushCmdDB = ""
+	err := push([]string{"nosuchdb1.sqlite", "nosuchdb2.sqlite"})
+	c.Check(err, chk.ErrorMatches, "2 of 2 databases failed to push: nosuchdb1.sqlite, nosuchdb2.sqlite")
+	c.Check(strings.Count(s.buf.String(), ": failed - "), chk.Equals, 2)
+}
+
+// Test the "dio config" commands
+func (s *DioSuite) Test0330_Config(c *chk.C) {
+	// Change the author name in the config file
+	oldName := viper.GetString("user.name")
+	err := configSet([]string{"author", "Another Person"})
+	c.Assert(err, chk.IsNil)
+	c.Check(viper.GetString("user.name"), chk.Equals, "Another Person")
+
+	// Read it back
+	s.buf.Reset()
+	err = configGet([]string{"author"})
+	c.Assert(err, chk.IsNil)
+	c.Check(strings.TrimSpace(s.buf.String()), chk.Equals, "Another Person")
+
+	// The email address from the client certificate shouldn't have been written to the config file
+	err = configGet([]string{"email"})
+	c.Check(err, chk.NotNil)
+
+	// Unknown settings should be rejected
+	err = configSet([]string{"nosuchsetting", "foo"})
+	c.Check(err, chk.NotNil)
+
+	// Restore the original author name
+	err = configSet([]string{"author", oldName})
+	c.Assert(err, chk.IsNil)
+}
+
 // Mocked functions
 func mockGetLicences() (map[string]licenceEntry, error) {
 	return licList, nil
 }
 
+// Records the commit message template, then saves editorMsg in its place
+func mockLaunchEditor(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	editorTmpl = string(b)
+	return ioutil.WriteFile(path, []byte(editorMsg), 0644)
+}
+
 // Returns metadata of a database with a single commit, on the master branch
 func mockRetrieveMetadata(db string) (meta metaData, onCloud bool, err error) {
 	meta.Branches = make(map[string]branchEntry)
@@ -1214,6 +3446,7 @@ func mockRetrieveMetadata(db string) (meta metaData, onCloud bool, err error) {
 
 func mockServer() {
 	mux := http.NewServeMux()
+	mux.HandleFunc("/db_describe", mockServerDescribeHandler)
 	mux.HandleFunc("/default", mockServerDatabaseListHandler)
 	mux.HandleFunc("/default/19kBv2.sqlite", mockServerPushPullSwitchHandler)
 	mux.HandleFunc("/default/19kBv3.sqlite", mockServerNewDBPushHandler)
@@ -1221,6 +3454,7 @@ func mockServer() {
 	mux.HandleFunc("/licence/get", mockServerLicenceGetHandler)
 	mux.HandleFunc("/licence/remove", mockServerLicenceRemoveHandler)
 	mux.HandleFunc("/metadata/get", mockServerMetadataGetHandler)
+	mux.HandleFunc("/whoami", mockServerWhoamiHandler)
 	newServer = &http.Server{
 		Addr:         "localhost:5551",
 		Handler:      mux,
@@ -1231,6 +3465,8 @@ func mockServer() {
 }
 
 func mockServerDatabaseListHandler(w http.ResponseWriter, r *http.Request) {
+	lastAuth = r.Header.Get("Authorization")
+
 	// Convert the database entries to JSON
 	var msg bytes.Buffer
 	enc := json.NewEncoder(&msg)
@@ -1244,6 +3480,18 @@ func mockServerDatabaseListHandler(w http.ResponseWriter, r *http.Request) {
 	_, _ = fmt.Fprintf(w, "%s", dbList)
 }
 
+func mockServerDescribeHandler(w http.ResponseWriter, r *http.Request) {
+	// Update the description of a database in the test database list
+	name := r.FormValue("dbname")
+	for i, j := range mockDBEntries {
+		if j.Name == name {
+			mockDBEntries[i].Description = r.FormValue("description")
+			return
+		}
+	}
+	http.Error(w, "Database not found", http.StatusNotFound)
+}
+
 func mockServerLicenceAddHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the form variables
 	licID := r.FormValue("licence_id")
@@ -1358,6 +3606,7 @@ func mockServerMetadataGetHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func mockServerNewDBPushHandler(w http.ResponseWriter, r *http.Request) {
+	lastIdemKey = r.Header.Get("Idempotency-Key")
 	expected := map[string]string{
 		"authoremail":    "testdefault@dbhub.io",
 		"authorname":     "Default test user",
@@ -1569,3 +3818,15 @@ func mockServerPushPullSwitchHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	return
 }
+
+func mockServerWhoamiHandler(w http.ResponseWriter, r *http.Request) {
+	// Return the identity of the (only) test user
+	err := json.NewEncoder(w).Encode(whoamiEntry{
+		Email:    "testdefault@dbhub.io",
+		Name:     "Default test user",
+		Username: "default",
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var exportCmdFormat, exportCmdOutput string
+
+// Exports the history of a database, for importing into other version control systems
+var exportCmd = &cobra.Command{
+	Use:   "export [database name]",
+	Short: "Export the history of a database as a git fast-import stream",
+	Long: `Writes the commit history of a database as a git fast-import stream.  Each commit becomes a git commit,
+with the database file named after the database.  Branches and tags are included too.  For example:
+
+  dio export mydb.sqlite | git fast-import`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return export(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVar(&exportCmdFormat, "format", "git-fast-import",
+		"Format of the export.  Only git-fast-import is supported at the moment")
+	exportCmd.Flags().StringVarP(&exportCmdOutput, "output", "o", "",
+		"Path to write the export to.  Defaults to standard output")
+}
+
+func export(args []string) (err error) {
+	// Ensure a database file was given
+	var db string
+	if len(args) == 0 {
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+	} else {
+		db = args[0]
+	}
+	if len(args) > 1 {
+		return errors.New("Only one database can be exported at a time (for now)")
+	}
+	if exportCmdFormat != "git-fast-import" {
+		return fmt.Errorf("Unknown export format '%s'.  Only 'git-fast-import' is supported", exportCmdFormat)
+	}
+
+	// Load the metadata
+	meta, err := loadMetadata(db)
+	if err != nil {
+		return
+	}
+
+	// Write the export to standard output, unless a file was given
+	out := fOut
+	toFile := exportCmdOutput != "" && exportCmdOutput != "-"
+	if toFile {
+		var f *os.File
+		f, err = os.Create(exportCmdOutput)
+		if err != nil {
+			return
+		}
+		defer func() {
+			errInner := f.Close()
+			if err == nil {
+				err = errInner
+			}
+		}()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	numCommits, err := exportGitFastImport(w, db, meta)
+	if err != nil {
+		return
+	}
+	err = w.Flush()
+	if err != nil {
+		return
+	}
+	if toFile {
+		_, err = numFormat.Fprintf(fOut, "%d commit(s) from '%s' exported to %s\n", numCommits, db,
+			exportCmdOutput)
+	}
+	return
+}
+
+// Writes the commit history as a git fast-import stream.  Parent commits are always written before their children,
+// as fast-import needs them to already exist
+func exportGitFastImport(w io.Writer, db string, meta metaData) (numCommits int, err error) {
+	var branches []string
+	for i := range meta.Branches {
+		branches = append(branches, i)
+	}
+	sort.Strings(branches)
+
+	// Work out the order to write the commits in, along with the branch each one is first reached from
+	type stackEntry struct {
+		id       string
+		expanded bool
+	}
+	var order []string
+	branchOf := make(map[string]string)
+	for _, br := range branches {
+		stack := []stackEntry{{id: meta.Branches[br].Commit}}
+		for len(stack) > 0 {
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if _, ok := branchOf[e.id]; ok {
+				continue
+			}
+			c, ok := meta.Commits[e.id]
+			if !ok {
+				return 0, fmt.Errorf("Commit '%s' is missing from the local metadata", e.id)
+			}
+			if e.expanded {
+				branchOf[e.id] = br
+				order = append(order, e.id)
+				continue
+			}
+			stack = append(stack, stackEntry{id: e.id, expanded: true})
+			for i := len(c.OtherParents) - 1; i >= 0; i-- {
+				stack = append(stack, stackEntry{id: c.OtherParents[i]})
+			}
+			if c.Parent != "" {
+				stack = append(stack, stackEntry{id: c.Parent})
+			}
+		}
+	}
+
+	// Write out the commits, along with the database files they need
+	path := db
+	if strings.ContainsAny(path, "\n\"") {
+		path = strconv.Quote(path)
+	}
+	mark := 0
+	blobMarks := make(map[string]int)
+	commitMarks := make(map[string]int)
+	for _, id := range order {
+		c := meta.Commits[id]
+		var dbSHA string
+		for _, e := range c.Tree.Entries {
+			if e.EntryType == DATABASE {
+				dbSHA = e.Sha256
+			}
+		}
+		if _, ok := blobMarks[dbSHA]; dbSHA != "" && !ok {
+			err = checkDBCache(db, dbSHA, id)
+			if err != nil {
+				return
+			}
+			var b []byte
+			b, err = ioutil.ReadFile(filepath.Join(".dio", db, "db", dbSHA))
+			if err != nil {
+				return
+			}
+			mark++
+			blobMarks[dbSHA] = mark
+			_, err = fmt.Fprintf(w, "blob\nmark :%d\ndata %d\n", mark, len(b))
+			if err != nil {
+				return
+			}
+			_, err = w.Write(append(b, '\n'))
+			if err != nil {
+				return
+			}
+		}
+
+		// Commits without a parent start from an empty branch, rather than the last commit written to it
+		ref := "refs/heads/" + branchOf[id]
+		if c.Parent == "" {
+			_, err = fmt.Fprintf(w, "reset %s\n", ref)
+			if err != nil {
+				return
+			}
+		}
+		mark++
+		commitMarks[id] = mark
+		_, err = fmt.Fprintf(w, "commit %s\nmark :%d\n", ref, mark)
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(w, "author %s <%s> %d +0000\n", c.AuthorName, c.AuthorEmail,
+			commitAuthorTime(c).Unix())
+		if err != nil {
+			return
+		}
+		// Commits from before the committer was recorded separately (and those made on the server) don't have
+		// one, which git fast-import won't accept.  The author is the committer for those
+		committerName, committerEmail, committerTime := c.CommitterName, c.CommitterEmail, commitCommitterTime(c)
+		if committerName == "" || committerEmail == "" {
+			committerName, committerEmail, committerTime = c.AuthorName, c.AuthorEmail, commitAuthorTime(c)
+		}
+		_, err = fmt.Fprintf(w, "committer %s <%s> %d +0000\n", committerName, committerEmail,
+			committerTime.Unix())
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(w, "data %d\n%s\n", len(c.Message), c.Message)
+		if err != nil {
+			return
+		}
+		if c.Parent != "" {
+			_, err = fmt.Fprintf(w, "from :%d\n", commitMarks[c.Parent])
+			if err != nil {
+				return
+			}
+		}
+		for _, p := range c.OtherParents {
+			_, err = fmt.Fprintf(w, "merge :%d\n", commitMarks[p])
+			if err != nil {
+				return
+			}
+		}
+		if dbSHA == "" {
+			_, err = fmt.Fprint(w, "deleteall\n\n")
+		} else {
+			_, err = fmt.Fprintf(w, "M 644 :%d %s\n\n", blobMarks[dbSHA], path)
+		}
+		if err != nil {
+			return
+		}
+		numCommits++
+	}
+
+	// Point each branch at its head commit, and add the tags
+	for _, br := range branches {
+		_, err = fmt.Fprintf(w, "reset refs/heads/%s\nfrom :%d\n\n", br, commitMarks[meta.Branches[br].Commit])
+		if err != nil {
+			return
+		}
+	}
+	var tags []string
+	for i := range meta.Tags {
+		tags = append(tags, i)
+	}
+	sort.Strings(tags)
+	for _, t := range tags {
+		m, ok := commitMarks[meta.Tags[t].Commit]
+		if !ok {
+			continue
+		}
+		_, err = fmt.Fprintf(w, "reset refs/tags/%s\nfrom :%d\n\n", t, m)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
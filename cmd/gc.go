@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var gcCmdExpire int
+var gcCmdPrune bool
+
+// Removes cached database files and commits which are no longer referenced
+var gcCmd = &cobra.Command{
+	Use:   "gc [database name]",
+	Short: "Clean up cached database files and commits that are no longer needed",
+	Long: `Finds the commits in the local metadata which aren't reachable from a branch, tag, release, or reflog
+entry, and the cached database files in .dio which aren't used by any of the reachable commits.  By default these
+are only listed.  Use --prune to delete them.
+
+Reflog entries older than --expire days stop keeping their commits, and are removed along with them by --prune.
+This lets commits which were reset or squashed away be cleaned up eventually.  Use --expire 0 to expire every
+reflog entry now.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return gc(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(gcCmd)
+	gcCmd.Flags().IntVar(&gcCmdExpire, "expire", 90,
+		"Number of days reflog entries keep their commits for")
+	gcCmd.Flags().BoolVar(&gcCmdPrune, "prune", false,
+		"Delete the unreferenced files and commits, instead of just listing them")
+}
+
+func gc(args []string) error {
+	if len(args) > 1 {
+		return errors.New("Only one database can be cleaned up at a time (for now)")
+	}
+
+	// If no database name was given, clean up all of the databases with local metadata
+	dbList := args
+	if len(dbList) == 0 {
+		dirs, err := ioutil.ReadDir(".dio")
+		if err != nil {
+			if os.IsNotExist(err) {
+				return errors.New("No local metadata found in this directory")
+			}
+			return err
+		}
+		for _, j := range dirs {
+			if !j.IsDir() {
+				continue
+			}
+			if _, err = os.Stat(filepath.Join(".dio", j.Name(), "metadata.json")); err == nil {
+				dbList = append(dbList, j.Name())
+			}
+		}
+	}
+
+	var numCommits, numFiles int
+	var numBytes int64
+	for _, db := range dbList {
+		commits, files, size, err := gcDatabase(db)
+		if err != nil {
+			return err
+		}
+		numCommits += commits
+		numFiles += files
+		numBytes += size
+	}
+
+	// Let the user know what was (or would be) cleaned up
+	if numCommits == 0 && numFiles == 0 {
+		_, err := fmt.Fprintln(fOut, "No unreferenced files or commits found")
+		return err
+	}
+	if gcCmdPrune {
+		_, err := numFormat.Fprintf(fOut, "\n%d unreferenced commit(s) and %d file(s) removed, freeing %d bytes\n",
+			numCommits, numFiles, numBytes)
+		return err
+	}
+	_, err := numFormat.Fprintf(fOut, "\n%d unreferenced commit(s) and %d file(s) found, using %d bytes.  Use "+
+		"--prune to remove them\n", numCommits, numFiles, numBytes)
+	return err
+}
+
+// Lists (or removes, with --prune) the unreferenced commits in the local metadata for a database, and the
+// unreferenced files in its local cache
+func gcDatabase(db string) (numCommits int, numFiles int, numBytes int64, err error) {
+	meta, err := localFetchMetadata(db, false)
+	if err != nil {
+		return
+	}
+
+	// Start from every branch head, tag, release, and unexpired reflog entry, plus any checked out commit, then
+	// walk back through all of the parent commits.  The reflog entries are kept so 'dio reset' can still use them
+	cutoff := time.Now().UTC().AddDate(0, 0, -gcCmdExpire)
+	heads, err := reflogCommits(db, cutoff)
+	if err != nil {
+		return
+	}
+	if meta.CheckedOut != "" {
+		heads = append(heads, meta.CheckedOut)
+	}
+	for _, j := range meta.Branches {
+		heads = append(heads, j.Commit)
+	}
+	for _, j := range meta.Tags {
+		heads = append(heads, j.Commit)
+	}
+	for _, j := range meta.Releases {
+		heads = append(heads, j.Commit)
+	}
+	seen := make(map[string]bool)
+	live := make(map[string]bool)
+	for len(heads) > 0 {
+		id := heads[0]
+		heads = heads[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		c, ok := meta.Commits[id]
+		if !ok {
+			continue
+		}
+		for _, e := range c.Tree.Entries {
+			live[e.Sha256] = true
+		}
+		if c.Parent != "" {
+			heads = append(heads, c.Parent)
+		}
+		heads = append(heads, c.OtherParents...)
+	}
+
+	// Remove the commits which can't be reached any more
+	var unusedCommits []string
+	for id := range meta.Commits {
+		if !seen[id] {
+			unusedCommits = append(unusedCommits, id)
+		}
+	}
+	sort.Strings(unusedCommits)
+	for _, id := range unusedCommits {
+		_, err = fmt.Fprintf(fOut, "  * %s: commit %s\n", db, id)
+		if err != nil {
+			return
+		}
+		delete(meta.Commits, id)
+		numCommits++
+	}
+	if gcCmdPrune {
+		if numCommits > 0 {
+			err = saveMetadata(db, meta)
+			if err != nil {
+				return
+			}
+		}
+		err = reflogExpire(db, cutoff)
+		if err != nil {
+			return
+		}
+	}
+
+	// Check each of the files in the cache against the list of referenced ones
+	files, err := ioutil.ReadDir(filepath.Join(".dio", db, "db"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	var unused []os.FileInfo
+	for _, j := range files {
+		if !j.IsDir() && !live[j.Name()] {
+			unused = append(unused, j)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool { return unused[i].Name() < unused[j].Name() })
+	for _, j := range unused {
+		if gcCmdPrune {
+			err = os.Remove(filepath.Join(".dio", db, "db", j.Name()))
+			if err != nil {
+				return
+			}
+		}
+		_, err = numFormat.Fprintf(fOut, "  * %s: %s (%d bytes)\n", db, j.Name(), j.Size())
+		if err != nil {
+			return
+		}
+		numFiles++
+		numBytes += j.Size()
+	}
+	return
+}
@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var importCmdBranch, importCmdFrom, importCmdSourceBranch string
+
+// Copies the history of a branch from another dio repository into this one
+var importCmd = &cobra.Command{
+	Use:   "import [database name] [source directory]",
+	Short: "Import the history of a branch from another dio repository",
+	Long: `Copies the commits and cached database files of a branch from the dio repository (the directory
+containing the .dio folder) in the source directory, into a new branch of the database here.  Every commit
+and database file is checked before being accepted.  If the database has a different name in the source
+repository, the commits are rewritten to use the name here, which gives them different commit IDs.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return importDB(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVar(&importCmdBranch, "branch", "",
+		"Name of the branch to create.  Defaults to the name of the source branch")
+	importCmd.Flags().StringVar(&importCmdFrom, "from", "",
+		"Name of the database in the source repository.  Defaults to the same name as here")
+	importCmd.Flags().StringVar(&importCmdSourceBranch, "source-branch", "",
+		"Branch of the source database to import.  Defaults to its active branch")
+}
+
+func importDB(args []string) error {
+	// Ensure a source directory was given, with an optional database name
+	var db, srcDir string
+	var err error
+	switch len(args) {
+	case 1:
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+		srcDir = args[0]
+	case 2:
+		db, srcDir = args[0], args[1]
+	default:
+		return errors.New("The directory of the dio repository to import from is needed")
+	}
+	fi, err := os.Stat(srcDir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("'%s' isn't a directory.  Only importing from dio repositories is supported at the "+
+			"moment", srcDir)
+	}
+
+	// Load the metadata of the source database
+	srcDB := importCmdFrom
+	if srcDB == "" {
+		srcDB = db
+	}
+	md, err := ioutil.ReadFile(filepath.Join(srcDir, ".dio", srcDB, "metadata.json"))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("No local metadata for '%s' exists in '%s'", srcDB, srcDir)
+	}
+	if err != nil {
+		return err
+	}
+	var srcMeta metaData
+	err = json.Unmarshal(md, &srcMeta)
+	if err != nil {
+		return err
+	}
+	if importCmdSourceBranch == "" {
+		importCmdSourceBranch = srcMeta.ActiveBranch
+	}
+	srcHead, ok := srcMeta.Branches[importCmdSourceBranch]
+	if !ok {
+		return fmt.Errorf("Branch '%s' doesn't exist in the source database", importCmdSourceBranch)
+	}
+
+	// Load the metadata here, starting fresh if there isn't any yet
+	if importCmdBranch == "" {
+		importCmdBranch = importCmdSourceBranch
+	}
+	var meta metaData
+	if _, err = os.Stat(filepath.Join(".dio", db, "metadata.json")); os.IsNotExist(err) {
+		meta = newMetaStruct(importCmdBranch)
+	} else {
+		meta, err = loadMetadata(db)
+		if err != nil {
+			return err
+		}
+		if _, ok = meta.Branches[importCmdBranch]; ok {
+			return fmt.Errorf("A branch named '%s' already exists", importCmdBranch)
+		}
+	}
+
+	// Work out the order to import the commits in, so parents are always handled before their children.  Each
+	// commit is checked against its ID along the way, so nothing is imported if any of them are wrong
+	type stackEntry struct {
+		id       string
+		expanded bool
+	}
+	var order []string
+	done := make(map[string]bool)
+	stack := []stackEntry{{id: srcHead.Commit}}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if done[e.id] {
+			continue
+		}
+		c, ok := srcMeta.Commits[e.id]
+		if !ok {
+			return fmt.Errorf("Commit '%s' is missing from the source metadata", e.id)
+		}
+		if e.expanded {
+			if c.ID != e.id || createDBTreeID(c.Tree.Entries) != c.Tree.ID || createCommitID(c) != c.ID {
+				return fmt.Errorf("Aborting: commit '%s' in the source metadata doesn't match its contents", e.id)
+			}
+			done[e.id] = true
+			order = append(order, e.id)
+			continue
+		}
+		stack = append(stack, stackEntry{id: e.id, expanded: true})
+		for _, p := range c.OtherParents {
+			stack = append(stack, stackEntry{id: p})
+		}
+		if c.Parent != "" {
+			stack = append(stack, stackEntry{id: c.Parent})
+		}
+	}
+
+	// Copy the commits and their database files, rewriting the commits which need the database name changing
+	newIDs := make(map[string]string)
+	var numImported, numRewritten int
+	for _, id := range order {
+		c := srcMeta.Commits[id]
+		newCom := c
+		newCom.Tree.Entries = append([]dbTreeEntry(nil), c.Tree.Entries...)
+		for i, e := range newCom.Tree.Entries {
+			if e.EntryType != DATABASE {
+				continue
+			}
+			err = importCacheFile(srcDir, srcDB, db, e.Sha256)
+			if err != nil {
+				return err
+			}
+			newCom.Tree.Entries[i].Name = db
+		}
+		newCom.Tree.ID = createDBTreeID(newCom.Tree.Entries)
+		if c.Parent != "" {
+			newCom.Parent = newIDs[c.Parent]
+		}
+		newCom.OtherParents = nil
+		for _, p := range c.OtherParents {
+			newCom.OtherParents = append(newCom.OtherParents, newIDs[p])
+		}
+		newCom.ID = createCommitID(newCom)
+		if newCom.ID != c.ID {
+			// Any signature was for the original commit ID, so it doesn't apply to the rewritten one
+			newCom.Signature = ""
+			newCom.SigningKeyID = ""
+			numRewritten++
+		}
+		newIDs[id] = newCom.ID
+		if _, ok := meta.Commits[newCom.ID]; !ok {
+			meta.Commits[newCom.ID] = newCom
+			numImported++
+		}
+	}
+	meta.Branches[importCmdBranch] = branchEntry{
+		Commit:      newIDs[srcHead.Commit],
+		CommitCount: srcHead.CommitCount,
+		Description: srcHead.Description,
+	}
+
+	// Save the updated metadata back to disk
+	err = saveMetadata(db, meta)
+	if err != nil {
+		return err
+	}
+	_, err = numFormat.Fprintf(fOut, "%d commit(s) imported into branch '%s' of '%s'\n", numImported,
+		importCmdBranch, db)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Head commit: %s\n", newIDs[srcHead.Commit])
+	if err != nil {
+		return err
+	}
+	if numRewritten > 0 {
+		_, err = numFormat.Fprintf(fOut, "    %d commit ID(s) changed, as the database is named '%s' in the "+
+			"source repository\n", numRewritten, srcDB)
+	}
+	return err
+}
+
+// Copies a database file from the cache of the source repository (or the shared cache) into the local cache,
+// checking it matches its checksum on the way through
+func importCacheFile(srcDir string, srcDB string, db string, shaSum string) error {
+	dest := filepath.Join(".dio", db, "db", shaSum)
+	if _, err := os.Stat(dest); err == nil {
+		return nil
+	}
+	b, err := ioutil.ReadFile(filepath.Join(srcDir, ".dio", srcDB, "db", shaSum))
+	if os.IsNotExist(err) {
+		var found bool
+		b, found, err = cacheRead(shaSum)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("Database file '%s' isn't in the cache of the source repository", shaSum)
+		}
+	} else if err != nil {
+		return err
+	}
+	s := sha256.Sum256(b)
+	if thisSum := hex.EncodeToString(s[:]); thisSum != shaSum {
+		return fmt.Errorf("Aborting: database file '%s' in the source repository has checksum '%s'", shaSum,
+			thisSum)
+	}
+	err = os.MkdirAll(filepath.Join(".dio", db, "db"), 0770)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dest, b, 0644)
+}
@@ -55,6 +55,12 @@ var infoCmd = &cobra.Command{
 		} else {
 			fmt.Println("Email address not set in configuration file")
 		}
+		if found := viper.IsSet("user.editor"); found == true {
+			fmt.Printf("Editor for commit messages: %s\n", viper.Get("user.editor"))
+		}
+		if found := viper.IsSet("user.template"); found == true {
+			fmt.Printf("Commit message template file: %s\n", viper.Get("user.template"))
+		}
 		return nil
 	},
 }
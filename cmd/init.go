@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	initCmdAuthEmail, initCmdAuthName, initCmdLicence, initCmdMsg string
+	initCmdForce                                                  bool
+)
+
+// Starts tracking an existing local database, without needing to push it to a server first
+var initCmd = &cobra.Command{
+	Use:   "init [database file]",
+	Short: "Start tracking the history of an existing local database",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return initDB(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(initCmd)
+	initCmd.Flags().StringVar(&initCmdAuthEmail, "email", "", "Email address of the commit author")
+	initCmd.Flags().BoolVar(&initCmdForce, "force", false,
+		"Replace any existing local metadata for the database")
+	initCmd.Flags().StringVar(&initCmdLicence, "licence", "",
+		"The licence (ID) for the database, as per 'dio licence list'")
+	initCmd.Flags().StringVar(&initCmdMsg, "message", "Initial commit", "Description / commit message")
+	initCmd.Flags().StringVar(&initCmdAuthName, "name", "", "Name of the commit author")
+}
+
+func initDB(args []string) error {
+	// Ensure a database file was given
+	if len(args) == 0 {
+		return errors.New("No database file specified")
+	}
+	if len(args) > 1 {
+		return errors.New("Only one database can be initialised at a time (for now)")
+	}
+	db := args[0]
+
+	// Ensure the database file exists, and is an SQLite database
+	fi, err := os.Stat(db)
+	if err != nil {
+		return err
+	}
+	err = checkSQLiteHeader(db)
+	if err != nil {
+		return err
+	}
+
+	// Refuse to replace existing metadata, unless forced
+	if _, err = os.Stat(filepath.Join(".dio", db)); err == nil {
+		if !initCmdForce {
+			return fmt.Errorf("Local metadata for '%s' already exists.  Use --force to replace it", db)
+		}
+		err = os.RemoveAll(filepath.Join(".dio", db))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Grab author name & email from the dio config file, but allow command line flags to override them
+	var authorName, authorEmail, committerName, committerEmail string
+	if z, ok := viper.Get("user.name").(string); ok {
+		authorName = z
+		committerName = z
+	}
+	if z, ok := viper.Get("user.email").(string); ok {
+		authorEmail = z
+		committerEmail = z
+	}
+	if initCmdAuthName != "" {
+		authorName = initCmdAuthName
+	}
+	if initCmdAuthEmail != "" {
+		authorEmail = initCmdAuthEmail
+	}
+	if authorName == "" || authorEmail == "" || committerName == "" || committerEmail == "" {
+		return errors.New("Author and committer name and email addresses are required!")
+	}
+
+	// Determine the SHA256 of the requested licence.  If none was given, the database is tracked without one, so
+	// the server doesn't need to be contacted
+	var licID, licSHA string
+	if initCmdLicence != "" {
+		licList, err := getLicences()
+		if err != nil {
+			return err
+		}
+		for i, j := range licList {
+			if strings.ToLower(i) == strings.ToLower(initCmdLicence) {
+				licID = i
+				licSHA = j.Sha256
+				break
+			}
+		}
+		if licID == "" {
+			return fmt.Errorf("Unknown licence '%s'.  'dio licence list' shows the available ones", initCmdLicence)
+		}
+	}
+
+	// Read the database and generate its checksum
+	b, err := ioutil.ReadFile(db)
+	if err != nil {
+		return err
+	}
+	s := sha256.Sum256(b)
+	shaSum := hex.EncodeToString(s[:])
+
+	// Create the initial commit on the master branch
+	e := dbTreeEntry{
+		EntryType:    DATABASE,
+		LastModified: fi.ModTime().UTC(),
+		LicenceSHA:   licSHA,
+		Name:         db,
+		Sha256:       shaSum,
+		Size:         fi.Size(),
+	}
+	newCom := commitEntry{
+		AuthorEmail:    authorEmail,
+		AuthorName:     authorName,
+		CommitterEmail: committerEmail,
+		CommitterName:  committerName,
+		Message:        normaliseMessage(initCmdMsg),
+		Timestamp:      time.Now().UTC(),
+		Tree:           dbTree{Entries: []dbTreeEntry{e}},
+	}
+	newCom.Tree.ID = createDBTreeID(newCom.Tree.Entries)
+	newCom.ID = createCommitID(newCom)
+	meta := newMetaStruct("master")
+	meta.Commits[newCom.ID] = newCom
+	meta.Branches["master"] = branchEntry{Commit: newCom.ID, CommitCount: 1}
+
+	// Copy the database into the local cache, then save the metadata
+	err = os.MkdirAll(filepath.Join(".dio", db, "db"), 0770)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(filepath.Join(".dio", db, "db", shaSum), b, 0644)
+	if err != nil {
+		return err
+	}
+	err = saveMetadata(db, meta)
+	if err != nil {
+		return err
+	}
+
+	// If a default database isn't already selected, we use this one as the default
+	defDB, err := getDefaultDatabase()
+	if err != nil {
+		return err
+	}
+	if defDB == "" {
+		err = saveDefaultDatabase(db)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Display results to the user
+	_, err = fmt.Fprintf(fOut, "Initialised '%s'\n", db)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Commit ID: %s\n", newCom.ID)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(fOut, "    Branch: master")
+	if err != nil {
+		return err
+	}
+	if licID != "" {
+		_, err = fmt.Fprintf(fOut, "    Licence: %s\n", licID)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = numFormat.Fprintf(fOut, "    Size: %d bytes\n\n", e.Size)
+	return err
+}
@@ -7,7 +7,6 @@ import (
 	"net/url"
 	"os"
 
-	rq "github.com/parnurzeal/gorequest"
 	"github.com/spf13/cobra"
 )
 
@@ -62,7 +61,11 @@ func licenceAdd(args []string) error {
 
 	// Send the licence info to the API server
 	name := args[0]
-	req := rq.New().TLSClientConfig(&TLSConfig).Post(fmt.Sprintf("%s/licence/add", cloud)).
+	client, err := newTLSClient()
+	if err != nil {
+		return err
+	}
+	req := client.Post(fmt.Sprintf("%s/licence/add", cloud)).
 		Type("multipart").
 		Query(fmt.Sprintf("licence_id=%s", url.QueryEscape(name))).
 		Query(fmt.Sprintf("display_order=%d", licenceAddDisplayOrder)).
@@ -77,7 +80,7 @@ func licenceAdd(args []string) error {
 	if licenceAddURL != "" {
 		req.Query(fmt.Sprintf("source_url=%s", url.QueryEscape(licenceAddURL)))
 	}
-	resp, body, errs := req.End()
+	resp, body, errs := withToken(req).End()
 	if errs != nil {
 		_, err = fmt.Fprint(fOut, "Errors when adding licence:")
 		if err != nil {
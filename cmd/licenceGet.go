@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"strings"
 
-	rq "github.com/parnurzeal/gorequest"
 	"github.com/spf13/cobra"
 )
 
@@ -55,11 +54,15 @@ func licenceGet(args []string) error {
 	}
 
 	// Download the licence text
+	client, err := newTLSClient()
+	if err != nil {
+		return err
+	}
 	dlStatus := make(map[string]string)
 	for _, lic := range licenceList {
-		resp, body, errs := rq.New().TLSClientConfig(&TLSConfig).Get(cloud+"/licence/get").
+		resp, body, errs := withToken(client.Get(cloud+"/licence/get").
 			Query(fmt.Sprintf("licence=%s", lic)).
-			Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION)).
+			Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION))).
 			End()
 		if errs != nil {
 			for _, err := range errs {
@@ -93,7 +96,7 @@ func licenceGet(args []string) error {
 	}
 
 	// Display the status of the individual licence downloads
-	_, err := fmt.Fprintf(fOut, "Downloading licences from: %s...\n\n", cloud)
+	_, err = fmt.Fprintf(fOut, "Downloading licences from: %s...\n\n", cloud)
 	if err != nil {
 		return err
 	}
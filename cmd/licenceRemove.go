@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"net/url"
 
-	rq "github.com/parnurzeal/gorequest"
 	"github.com/spf13/cobra"
 )
 
@@ -34,9 +33,13 @@ func licenceRemove(args []string) error {
 
 	// Remove the licence
 	name := args[0]
-	resp, body, errs := rq.New().TLSClientConfig(&TLSConfig).Post(fmt.Sprintf("%s/licence/remove", cloud)).
+	client, err := newTLSClient()
+	if err != nil {
+		return err
+	}
+	resp, body, errs := withToken(client.Post(fmt.Sprintf("%s/licence/remove", cloud)).
 		Query(fmt.Sprintf("licence_id=%s", url.QueryEscape(name))).
-		Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION)).
+		Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION))).
 		End()
 	if errs != nil {
 		_, err := fmt.Fprint(fOut, "Errors when removing licence:")
@@ -55,6 +58,6 @@ func licenceRemove(args []string) error {
 		return errors.New(body)
 	}
 
-	_, err := fmt.Fprintf(fOut, "Licence '%s' removed\n", name)
+	_, err = fmt.Fprintf(fOut, "Licence '%s' removed\n", name)
 	return err
 }
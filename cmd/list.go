@@ -1,12 +1,19 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	listCmdContains, listCmdPrefix string
+	listCmdJSON                    bool
+)
+
 // Displays the list of databases on DBHub.io for the user.
 var listCmd = &cobra.Command{
 	Use:   "list",
@@ -18,6 +25,9 @@ var listCmd = &cobra.Command{
 
 func init() {
 	RootCmd.AddCommand(listCmd)
+	listCmd.Flags().StringVar(&listCmdContains, "contains", "", "Only list databases with names containing this")
+	listCmd.Flags().BoolVar(&listCmdJSON, "json", false, "Display the database list as JSON")
+	listCmd.Flags().StringVar(&listCmdPrefix, "prefix", "", "Only list databases with names starting with this")
 }
 
 func list(args []string) error {
@@ -30,12 +40,40 @@ func list(args []string) error {
 		return err
 	}
 
+	// If a name filter was given, only keep the matching databases
+	if listCmdContains != "" || listCmdPrefix != "" {
+		var filtered []dbListEntry
+		for _, j := range dbList {
+			if strings.HasPrefix(j.Name, listCmdPrefix) && strings.Contains(j.Name, listCmdContains) {
+				filtered = append(filtered, j)
+			}
+		}
+		dbList = filtered
+	}
+
+	// If JSON output was requested, display the list as it came from the server
+	if listCmdJSON {
+		if dbList == nil {
+			dbList = []dbListEntry{}
+		}
+		var j []byte
+		j, err = json.MarshalIndent(dbList, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(fOut, string(j))
+		return err
+	}
+
 	// Display the list of databases
 	if len(dbList) == 0 {
 		_, err = fmt.Fprintf(fOut, "Cloud '%s' has no databases\n", cloud)
 		return err
 	}
-	fmt.Printf("Databases on %s\n\n", cloud)
+	_, err = fmt.Fprintf(fOut, "Databases on %s\n\n", cloud)
+	if err != nil {
+		return err
+	}
 	for _, j := range dbList {
 		_, err = fmt.Fprintf(fOut, "  * Database: %s\n", j.Name)
 		if err != nil {
@@ -61,26 +99,25 @@ func list(args []string) error {
 				return err
 			}
 		} else {
-			_, err = fmt.Fprintf(fOut, "      Licence: Not specified")
+			_, err = fmt.Fprintf(fOut, "      Licence: Not specified\n")
 			if err != nil {
 				return err
 			}
 		}
 		// The server gives us the last modified and repo modified dates in pre-formatted UTC timezone.  For now, lets
-		// convert these back to the users local time
-		z, err := time.Parse(time.RFC3339, j.LastModified)
-		if err != nil {
-			return err
+		// convert these back to the users local time.  If they're in some other format, just show them as given
+		lastMod, repoMod := j.LastModified, j.RepoModified
+		if z, err := time.Parse(time.RFC3339, j.LastModified); err == nil {
+			lastMod = z.Local().Format(time.RFC1123)
 		}
-		_, err = fmt.Fprintf(fOut, "      File last modified: %s\n", z.Local().Format(time.RFC1123))
-		if err != nil {
-			return err
+		if z, err := time.Parse(time.RFC3339, j.RepoModified); err == nil {
+			repoMod = z.Local().Format(time.RFC1123)
 		}
-		z, err = time.Parse(time.RFC3339, j.RepoModified)
+		_, err = fmt.Fprintf(fOut, "      File last modified: %s\n", lastMod)
 		if err != nil {
 			return err
 		}
-		_, err = fmt.Fprintf(fOut, "      Repository last updated: %s\n\n", z.Local().Format(time.RFC1123))
+		_, err = fmt.Fprintf(fOut, "      Repository last updated: %s\n\n", repoMod)
 		if err != nil {
 			return err
 		}
@@ -3,12 +3,18 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 )
 
-var logBranch string
+var (
+	logBranch, logSince, logUntil string
+	logLimit                      int
+	logAll, logShort              bool
+)
 
 // Retrieves the commit history for a database branch
 var branchLogCmd = &cobra.Command{
@@ -21,8 +27,15 @@ var branchLogCmd = &cobra.Command{
 
 func init() {
 	RootCmd.AddCommand(branchLogCmd)
+	branchLogCmd.Flags().BoolVar(&logAll, "all", false,
+		"Display the history of all branches together, marking the branch heads")
 	branchLogCmd.Flags().StringVar(&logBranch, "branch", "", "Remote branch to retrieve the "+
 		"history of")
+	branchLogCmd.Flags().IntVar(&logLimit, "limit", 0, "Maximum number of commits to display")
+	branchLogCmd.Flags().BoolVar(&logShort, "short", false,
+		"Display commit IDs in short form, and only the first line of commit messages")
+	branchLogCmd.Flags().StringVar(&logSince, "since", "", "Only show commits made at or after this time (RFC3339)")
+	branchLogCmd.Flags().StringVar(&logUntil, "until", "", "Only show commits made at or before this time (RFC3339)")
 }
 
 func branchLog(args []string) error {
@@ -45,6 +58,21 @@ func branchLog(args []string) error {
 		return errors.New("only one database can be worked with at a time (for now)")
 	}
 
+	// If a time window was given, make sure it parses ok
+	var since, until time.Time
+	if logSince != "" {
+		since, err = time.Parse(time.RFC3339, logSince)
+		if err != nil {
+			return err
+		}
+	}
+	if logUntil != "" {
+		until, err = time.Parse(time.RFC3339, logUntil)
+		if err != nil {
+			return err
+		}
+	}
+
 	// If there is a local metadata cache for the requested database, use that.  Otherwise, retrieve it from the
 	// server first (without storing it)
 	var meta metaData
@@ -52,8 +80,14 @@ func branchLog(args []string) error {
 	if err != nil {
 		return err
 	}
+	if len(meta.Branches) == 0 {
+		return fmt.Errorf("No local metadata for '%s' exists, and it's not on %s either", db, cloud)
+	}
 
 	// If a branch name was given by the user, check if it exists
+	if logAll && logBranch != "" {
+		return errors.New("Either a branch name or --all can be given.  Not both at the same time!")
+	}
 	if logBranch != "" {
 		if _, ok := meta.Branches[logBranch]; ok == false {
 			return errors.New("That branch doesn't exist for the database")
@@ -74,39 +108,153 @@ func branchLog(args []string) error {
 		licList[j.Sha256] = j.FullName
 	}
 
-	// Display the commits for the branch
+	if logAll {
+		return branchLogAll(db, meta, licList, since, until)
+	}
+
+	// Display the commits for the branch, following the parent links back to the root commit
 	headID := meta.Branches[logBranch].Commit
-	localCommit := meta.Commits[headID]
+	localCommit, ok := meta.Commits[headID]
+	if !ok {
+		return errors.New("Something has gone wrong.  Head commit for the branch isn't in the commit list")
+	}
 	_, err = fmt.Fprintf(fOut, "Branch \"%s\" history for %s:\n\n", logBranch, db)
 	if err != nil {
 		return err
 	}
-	_, err = fmt.Fprint(fOut, createCommitText(meta.Commits[localCommit.ID], licList))
+	numShown := 0
+	for {
+		// The history is newest first, so once a commit is older than the window there's no need to go further
+		comTime := commitAuthorTime(localCommit)
+		if !since.IsZero() && comTime.Before(since) {
+			break
+		}
+		if until.IsZero() || !comTime.After(until) {
+			_, err = fmt.Fprint(fOut, createCommitText(localCommit, licList, logShort))
+			if err != nil {
+				return err
+			}
+			numShown++
+		}
+		if localCommit.Parent == "" || (logLimit > 0 && numShown >= logLimit) {
+			break
+		}
+		parentID := localCommit.Parent
+		localCommit, ok = meta.Commits[parentID]
+		if !ok {
+			return fmt.Errorf("Broken commit history: parent commit '%s' isn't in the commit list", parentID)
+		}
+	}
+	return nil
+}
+
+// Displays the commits from all of the branches together.  Children are always shown before their parents, with
+// the newest commit shown first where there's a choice, and each commit is only shown once
+func branchLogAll(db string, meta metaData, licList map[string]string, since time.Time, until time.Time) error {
+	// Find all of the commits reachable from a branch head, and count the children of each one
+	heads := make(map[string][]string)
+	var toCheck []string
+	for brName, br := range meta.Branches {
+		heads[br.Commit] = append(heads[br.Commit], brName)
+		toCheck = append(toCheck, br.Commit)
+	}
+	children := make(map[string]int)
+	seen := make(map[string]bool)
+	for len(toCheck) > 0 {
+		id := toCheck[0]
+		toCheck = toCheck[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		c, ok := meta.Commits[id]
+		if !ok {
+			return fmt.Errorf("Broken commit history: commit '%s' isn't in the commit list", id)
+		}
+		for _, p := range append([]string{c.Parent}, c.OtherParents...) {
+			if p != "" {
+				children[p]++
+				toCheck = append(toCheck, p)
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(fOut, "History of all branches for %s:\n\n", db)
 	if err != nil {
 		return err
 	}
-	for localCommit.Parent != "" {
-		localCommit = meta.Commits[localCommit.Parent]
-		_, err = fmt.Fprintf(fOut, createCommitText(meta.Commits[localCommit.ID], licList))
+	var ready []string
+	for id := range seen {
+		if children[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+	numShown := 0
+	for len(ready) > 0 && (logLimit == 0 || numShown < logLimit) {
+		// Pick the newest of the commits whose children have all been shown
+		n := 0
+		for i, id := range ready {
+			t, newest := commitCommitterTime(meta.Commits[id]), commitCommitterTime(meta.Commits[ready[n]])
+			if t.After(newest) || (t.Equal(newest) && id < ready[n]) {
+				n = i
+			}
+		}
+		c := meta.Commits[ready[n]]
+		ready = append(ready[:n], ready[n+1:]...)
+		for _, p := range append([]string{c.Parent}, c.OtherParents...) {
+			if p == "" {
+				continue
+			}
+			children[p]--
+			if children[p] == 0 {
+				ready = append(ready, p)
+			}
+		}
+
+		// Display the commit, marking any branches which point at it
+		comTime := commitAuthorTime(c)
+		if (!since.IsZero() && comTime.Before(since)) || (!until.IsZero() && comTime.After(until)) {
+			continue
+		}
+		txt := createCommitText(c, licList, logShort)
+		if br, ok := heads[c.ID]; ok {
+			sort.Strings(br)
+			txt = strings.Replace(txt, "\n", fmt.Sprintf(" (%s)\n", strings.Join(br, ", ")), 1)
+		}
+		_, err = fmt.Fprint(fOut, txt)
 		if err != nil {
 			return err
 		}
+		numShown++
 	}
 	return nil
 }
 
-// Creates the user visible commit text for a commit.
-func createCommitText(c commitEntry, licList map[string]string) string {
-	s := fmt.Sprintf("  * Commit: %s\n", c.ID)
+// Creates the user visible commit text for a commit.  If short is true, the commit ID is abbreviated and only the first
+// line of the message is included.
+func createCommitText(c commitEntry, licList map[string]string, short bool) string {
+	id := c.ID
+	if short {
+		id = shortID(id)
+	}
+	s := fmt.Sprintf("  * Commit: %s\n", id)
 	s += fmt.Sprintf("    Author: %s <%s>\n", c.AuthorName, c.AuthorEmail)
-	s += fmt.Sprintf("    Date: %v\n", c.Timestamp.Local().Format(time.RFC1123))
-	if c.Tree.Entries[0].LicenceSHA != "" {
+	s += fmt.Sprintf("    Date: %v\n", commitAuthorTime(c).Local().Format(time.RFC1123))
+	if !commitCommitterTime(c).Equal(commitAuthorTime(c)) {
+		s += fmt.Sprintf("    Committed: %v\n", commitCommitterTime(c).Local().Format(time.RFC1123))
+	}
+	if len(c.Tree.Entries) > 0 && c.Tree.Entries[0].LicenceSHA != "" {
 		s += fmt.Sprintf("    Licence: %s\n\n", licList[c.Tree.Entries[0].LicenceSHA])
 	} else {
 		s += fmt.Sprintf("\n")
 	}
+	// The short form only has the subject line of the message.  Otherwise each line of the body is indented too
 	if c.Message != "" {
-		s += fmt.Sprintf("      %s\n\n", c.Message)
+		msg := c.Message
+		if short {
+			msg = commitSubject(c)
+		}
+		s += fmt.Sprintf("      %s\n\n", strings.Replace(msg, "\n", "\n      ", -1))
 	}
 	return s
 }
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Lists the entries in the tree of a commit
+var lsFilesCmd = &cobra.Command{
+	Use:   "ls-files [database name] [commit]",
+	Short: "List the files in a commit",
+	Long: `Lists each of the files stored in the tree of a commit, with their type, size, checksum and last
+modified time.  The commit can be a commit ID, branch name, or tag name, and defaults to the head of the
+active branch.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return lsFiles(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(lsFilesCmd)
+}
+
+func lsFiles(args []string) error {
+	// Ensure a database file was given
+	var db string
+	var err error
+	if len(args) == 0 {
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+	} else {
+		db = args[0]
+	}
+	if len(args) > 2 {
+		return errors.New("Only one commit can be listed at a time (for now)")
+	}
+
+	// If there is a local metadata cache for the requested database, use that.  Otherwise, retrieve it from the
+	// server first (without storing it)
+	meta, err := localFetchMetadata(db, true)
+	if err != nil {
+		return err
+	}
+	if len(meta.Branches) == 0 {
+		return fmt.Errorf("No local metadata for '%s' exists, and it's not on %s either", db, cloud)
+	}
+	ref := meta.ActiveBranch
+	if len(args) == 2 {
+		ref = args[1]
+	}
+	c, err := resolveCommit(meta, ref)
+	if err != nil {
+		return err
+	}
+
+	// Map the licence sha256's to their friendly name for easy lookup
+	l, err := getLicences()
+	if err != nil {
+		return err
+	}
+	licList := make(map[string]string)
+	for _, j := range l {
+		licList[j.Sha256] = j.FullName
+	}
+
+	// Display the tree entries
+	_, err = fmt.Fprintf(fOut, "Files in commit %s:\n\n", c.ID)
+	if err != nil {
+		return err
+	}
+	return displayTreeEntries(c.Tree.Entries, licList)
+}
+
+// Displays the details of each entry in a commit tree
+func displayTreeEntries(entries []dbTreeEntry, licList map[string]string) (err error) {
+	if len(entries) == 0 {
+		_, err = fmt.Fprintln(fOut, "  No files")
+		return
+	}
+	for _, e := range entries {
+		_, err = fmt.Fprintf(fOut, "  * Name: %s\n", e.Name)
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(fOut, "    Type: %s\n", e.EntryType)
+		if err != nil {
+			return
+		}
+		_, err = numFormat.Fprintf(fOut, "    Size: %d bytes\n", e.Size)
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(fOut, "    SHA256: %s\n", e.Sha256)
+		if err != nil {
+			return
+		}
+		if e.LicenceSHA != "" {
+			lic, ok := licList[e.LicenceSHA]
+			if !ok {
+				lic = e.LicenceSHA
+			}
+			_, err = fmt.Fprintf(fOut, "    Licence: %s\n", lic)
+			if err != nil {
+				return
+			}
+		}
+		_, err = fmt.Fprintf(fOut, "    Last modified: %s\n\n", e.LastModified.Local().Format(time.RFC1123))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var mergeCmdDest, mergeCmdMsg, mergeCmdSource string
+
+// Merges one branch of a database into another
+var mergeCmd = &cobra.Command{
+	Use:   "merge [database name] --source xxx --dest yyy",
+	Short: "Merge one branch of a database into another",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return merge(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(mergeCmd)
+	mergeCmd.Flags().StringVar(&mergeCmdDest, "dest", "",
+		"Branch to merge into.  Defaults to the active branch")
+	mergeCmd.Flags().StringVar(&mergeCmdMsg, "message", "", "Commit message for the merge commit")
+	mergeCmd.Flags().StringVar(&mergeCmdSource, "source", "", "Branch to merge from")
+}
+
+func merge(args []string) error {
+	// Ensure a database file was given
+	var db string
+	var err error
+	if len(args) == 0 {
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+	} else {
+		db = args[0]
+	}
+	if len(args) > 1 {
+		return errors.New("Only one database can be changed at a time (for now)")
+	}
+
+	// Load the metadata
+	meta, err := loadMetadata(db)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the source and destination branches exist
+	if mergeCmdSource == "" {
+		return errors.New("No source branch given")
+	}
+	if mergeCmdDest == "" {
+		mergeCmdDest = meta.ActiveBranch
+	}
+	if mergeCmdSource == mergeCmdDest {
+		return errors.New("A branch can't be merged into itself")
+	}
+	srcBranch, ok := meta.Branches[mergeCmdSource]
+	if !ok {
+		return fmt.Errorf("The source branch '%s' doesn't exist", mergeCmdSource)
+	}
+	destBranch, ok := meta.Branches[mergeCmdDest]
+	if !ok {
+		return fmt.Errorf("The destination branch '%s' doesn't exist", mergeCmdDest)
+	}
+	srcCommit, ok := meta.Commits[srcBranch.Commit]
+	if !ok {
+		return errors.New("Something has gone wrong.  Head commit for the source branch isn't in the commit list")
+	}
+
+	// If the destination branch is checked out, don't overwrite any uncommitted changes to the database file
+	if mergeCmdDest == meta.ActiveBranch {
+		if _, err = os.Stat(db); err == nil {
+			changed, err := dbChanged(db, meta)
+			if err != nil {
+				return err
+			}
+			if changed {
+				return fmt.Errorf("%s has been changed since the last commit.  Please commit your changes "+
+					"before merging", db)
+			}
+		}
+	}
+
+	// If all of the source branch commits are already in the destination branch, there's nothing to do
+	if isAncestor(meta, srcBranch.Commit, destBranch.Commit) {
+		_, err = fmt.Fprintf(fOut, "Branch '%s' already contains all of the commits in '%s'\n", mergeCmdDest,
+			mergeCmdSource)
+		return err
+	}
+
+	var mergeType string
+	if isAncestor(meta, destBranch.Commit, srcBranch.Commit) {
+		// The destination branch head is in the history of the source branch, so we can just fast forward it
+		mergeType = "Fast forward"
+		meta.Branches[mergeCmdDest] = branchEntry{
+			Commit:      srcBranch.Commit,
+			CommitCount: srcBranch.CommitCount,
+			Description: destBranch.Description,
+		}
+	} else {
+		// The branches have diverged, so create a merge commit.  Databases are stored whole, so the merge commit uses
+		// the database from the source branch, with the destination branch head as its (first) parent
+		authorName := viper.GetString("user.name")
+		authorEmail := viper.GetString("user.email")
+		if authorName == "" || authorEmail == "" {
+			return errors.New("Author name and email addresses are required!")
+		}
+		mergeCmdMsg = normaliseMessage(mergeCmdMsg)
+		if mergeCmdMsg == "" {
+			mergeCmdMsg = fmt.Sprintf("Merge branch '%s' into '%s'", mergeCmdSource, mergeCmdDest)
+		}
+		mergeType = "Merge commit"
+		newCom := commitEntry{
+			AuthorName:     authorName,
+			AuthorEmail:    authorEmail,
+			CommitterName:  authorName,
+			CommitterEmail: authorEmail,
+			Message:        mergeCmdMsg,
+			OtherParents:   []string{srcBranch.Commit},
+			Parent:         destBranch.Commit,
+			Timestamp:      time.Now().UTC(),
+			Tree:           srcCommit.Tree,
+		}
+		newCom.ID = createCommitID(newCom)
+		meta.Commits[newCom.ID] = newCom
+		meta.Branches[mergeCmdDest] = branchEntry{
+			Commit:      newCom.ID,
+			CommitCount: destBranch.CommitCount + 1,
+			Description: destBranch.Description,
+		}
+	}
+
+	// The database file is updated below to match the new head, if it's the active branch
+	if mergeCmdDest == meta.ActiveBranch {
+		meta.CheckedOut = ""
+	}
+
+	// Save the updated metadata back to disk
+	err = saveMetadata(db, meta)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "Branch '%s' merged into '%s'\n", mergeCmdSource, mergeCmdDest)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * %s: %s\n", mergeType, meta.Branches[mergeCmdDest].Commit)
+	if err != nil {
+		return err
+	}
+
+	// If the destination branch is checked out, update the database file to match the new branch head
+	if mergeCmdDest != meta.ActiveBranch || len(srcCommit.Tree.Entries) == 0 {
+		return nil
+	}
+	entry := srcCommit.Tree.Entries[0]
+	b, err := ioutil.ReadFile(filepath.Join(".dio", db, "db", entry.Sha256))
+	if err != nil {
+		_, err = fmt.Fprintln(fOut, "  The merged database isn't in the local cache.  Use 'dio pull' to "+
+			"retrieve it")
+		return err
+	}
+	err = ioutil.WriteFile(db, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(db, time.Now(), entry.LastModified)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	rq "github.com/parnurzeal/gorequest"
+)
+
+// Wraps an upload body, displaying a progress bar on stderr as the data is read
+type progressReader struct {
+	lastPct int
+	r       io.Reader
+	sent    int64
+	total   int64
+}
+
+func (p *progressReader) Read(b []byte) (n int, err error) {
+	n, err = p.r.Read(b)
+	p.sent += int64(n)
+	sent := p.sent
+	if sent > p.total {
+		// The multipart encoding adds a little to the size of the database file
+		sent = p.total
+	}
+	pct := 100
+	if p.total > 0 {
+		pct = int(sent * 100 / p.total)
+	}
+	if pct != p.lastPct || err == io.EOF {
+		p.lastPct = pct
+		bar := strings.Repeat("=", pct*40/100) + strings.Repeat(" ", 40-pct*40/100)
+		_, _ = numFormat.Fprintf(os.Stderr, "\r  [%s] %3d%% (%d of %d bytes)", bar, pct, sent, p.total)
+		if err == io.EOF {
+			_, _ = fmt.Fprintln(os.Stderr)
+		}
+	}
+	return
+}
+
+// Returns true if a file is a character device, such as a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Sends a multipart upload request, displaying a progress bar for the upload of size bytes.  The progress bar is
+// skipped when quiet is set or the output isn't going to a terminal, so scripted output isn't affected.  It's also
+// skipped with --verbose, as the request is sent without gorequest then, which would bypass its debug logging
+func sendWithProgress(req *rq.SuperAgent, size int64, quiet bool) (rq.Response, string, []error) {
+	if quiet || verbose || !isTerminal(os.Stdout) || !isTerminal(os.Stderr) {
+		return req.End()
+	}
+	if len(req.Errors) != 0 {
+		return nil, "", req.Errors
+	}
+
+	// Build the request ourselves, so the body can be wrapped by the progress reader
+	req.TargetType = "multipart"
+	httpReq, err := req.MakeRequest()
+	if err != nil {
+		return nil, "", []error{err}
+	}
+	httpReq.Body = ioutil.NopCloser(&progressReader{lastPct: -1, r: httpReq.Body, total: size})
+	client := &http.Client{Transport: req.Transport}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, "", []error{err}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, "", []error{err}
+	}
+	return resp, string(body), nil
+}
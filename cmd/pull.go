@@ -12,10 +12,12 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var (
 	pullCmdBranch, pullCmdCommit string
+	pullCmdMerge, pullCmdReset   bool
 	pullForce                    *bool
 )
 
@@ -35,7 +37,11 @@ func init() {
 	pullCmd.Flags().StringVar(&pullCmdCommit, "commit", "",
 		"Commit ID of the database to download")
 	pullForce = pullCmd.Flags().BoolP("force", "f", false,
-		"Overwrite unsaved changes to the database?")
+		"Overwrite unsaved changes to the database, and local commits which have diverged from the remote branch?")
+	pullCmd.Flags().BoolVar(&pullCmdMerge, "merge", false,
+		"If the local branch has diverged from the remote one, join them with a merge commit")
+	pullCmd.Flags().BoolVar(&pullCmdReset, "reset", false,
+		"If the local branch has diverged from the remote one, discard the local commits")
 }
 
 func pull(args []string) error {
@@ -69,6 +75,12 @@ func pull(args []string) error {
 		return errors.New("Either a branch name or commit ID can be given.  Not both at the same time!")
 	}
 
+	// If the local branch has diverged from the remote one, refuse to continue unless told how to resolve it
+	resolved, err := pullCheckDivergence(db)
+	if err != nil {
+		return err
+	}
+
 	// Retrieve metadata for the database
 	var meta metaData
 	meta, err = updateMetadata(db, false) // Don't store the metadata to disk yet, in case the download fails
@@ -77,9 +89,10 @@ func pull(args []string) error {
 	}
 
 	// If the database file already exists locally, check whether the file has changed since the last commit, and let
-	// the user know.  The --force option on the command line overrides this
+	// the user know.  The --force option on the command line overrides this.  When a diverged branch was just merged
+	// or reset, the file was already checked against the old branch head
 	if _, err = os.Stat(db); err == nil {
-		if *pullForce == false {
+		if *pullForce == false && !resolved {
 			changed, err := dbChanged(db, meta)
 			if err != nil {
 				return err
@@ -127,6 +140,27 @@ func pull(args []string) error {
 		lastMod = thisCommit.Tree.Entries[0].LastModified
 	}
 
+	// If the database file isn't in the local cache but is in the shared one, copy it across so the local cache
+	// can be used
+	if thisSha != "" {
+		if _, err = os.Stat(filepath.Join(".dio", db, "db", thisSha)); os.IsNotExist(err) {
+			b, found, err := cacheRead(thisSha)
+			if err != nil {
+				return err
+			}
+			if found {
+				err = os.MkdirAll(filepath.Join(".dio", db, "db"), 0770)
+				if err != nil {
+					return err
+				}
+				err = writeFileAtomic(filepath.Join(".dio", db, "db", thisSha), b, 0644)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
 	// Check if the database file already exists in local cache
 	if thisSha != "" {
 		if _, err = os.Stat(filepath.Join(".dio", db, "db", thisSha)); err == nil {
@@ -189,6 +223,7 @@ func pull(args []string) error {
 			} else {
 				meta.Branches[pullCmdBranch] = newBranch
 			}
+			meta.CheckedOut = ""
 
 			// Save the updated metadata to disk
 			err = saveMetadata(db, meta)
@@ -236,7 +271,11 @@ func pull(args []string) error {
 	shaSum := hex.EncodeToString(s[:])
 
 	// Write the database file to disk in the cache directory
-	err = ioutil.WriteFile(filepath.Join(".dio", db, "db", shaSum), body, 0644)
+	err = writeFileAtomic(filepath.Join(".dio", db, "db", shaSum), body, 0644)
+	if err != nil {
+		return err
+	}
+	err = cacheStore(shaSum, body)
 	if err != nil {
 		return err
 	}
@@ -273,7 +312,8 @@ func pull(args []string) error {
 		meta.ActiveBranch = branch
 	}
 
-	// The download succeeded, so save the updated metadata to disk
+	// The download succeeded, so save the updated metadata to disk.  The database file now matches the branch
+	meta.CheckedOut = ""
 	err = saveMetadata(db, meta)
 	if err != nil {
 		return err
@@ -312,3 +352,144 @@ func pull(args []string) error {
 	_, err = numFormat.Fprintf(fOut, "  * Size: %d bytes\n", len(body))
 	return err
 }
+
+// Checks whether the local branch has diverged from the remote one, meaning neither head is in the history of the
+// other.  If it has, the pull is refused unless --merge or --reset (or --force) was given.  Returns true when the
+// divergence was resolved
+func pullCheckDivergence(db string) (resolved bool, err error) {
+	// If there's no local metadata yet, there's nothing to diverge from
+	localMeta, err := localFetchMetadata(db, false)
+	if err != nil {
+		return false, nil
+	}
+
+	// Only branches which exist both locally and on the remote server can diverge
+	branch := pullCmdBranch
+	if branch == "" {
+		branch = localMeta.ActiveBranch
+	}
+	localBranch, ok := localMeta.Branches[branch]
+	if !ok {
+		return false, nil
+	}
+	remoteMeta, onCloud, err := retrieveMetadata(db)
+	if err != nil {
+		return false, err
+	}
+	if !onCloud {
+		return false, nil
+	}
+	remoteBranch, ok := remoteMeta.Branches[branch]
+	if !ok {
+		return false, nil
+	}
+
+	// If either branch head is contained in the other branch, then the histories haven't diverged
+	if isAncestor(remoteMeta, localBranch.Commit, remoteBranch.Commit) ||
+		isAncestor(localMeta, remoteBranch.Commit, localBranch.Commit) {
+		return false, nil
+	}
+
+	// Show where the two branches split, working from the commits known either locally or remotely
+	allMeta := metaData{Commits: make(map[string]commitEntry)}
+	for id, c := range remoteMeta.Commits {
+		allMeta.Commits[id] = c
+	}
+	for id, c := range localMeta.Commits {
+		allMeta.Commits[id] = c
+	}
+	ancestor := commonAncestor(allMeta, localBranch.Commit, remoteBranch.Commit)
+	if ancestor == "" {
+		ancestor = "none"
+	}
+	_, err = fmt.Fprintf(fOut, "Local branch '%s' has diverged from the remote branch\n", branch)
+	if err != nil {
+		return false, err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Local head: %s\n", localBranch.Commit)
+	if err != nil {
+		return false, err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Remote head: %s\n", remoteBranch.Commit)
+	if err != nil {
+		return false, err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Common ancestor: %s\n", ancestor)
+	if err != nil {
+		return false, err
+	}
+	if pullCmdMerge && pullCmdReset {
+		return false, errors.New("Either --merge or --reset can be used.  Not both!")
+	}
+	if pullCmdMerge && *pullForce {
+		return false, errors.New("Either --merge or --force can be used.  Not both!")
+	}
+	if !pullCmdMerge && !pullCmdReset && !*pullForce {
+		return false, fmt.Errorf("Local branch '%s' has diverged from the remote branch.  Use --merge to create a merge "+
+			"commit joining them, or --reset to discard the local commits", branch)
+	}
+
+	// Resetting throws away the local commits, which protected branches don't allow
+	if !pullCmdMerge && isProtected(localMeta, branch) {
+		return false, fmt.Errorf("Branch '%s' is protected, so its local commits can't be discarded.  Use --merge "+
+			"to join it with the remote branch instead", branch)
+	}
+
+	// Both ways of resolving the divergence replace the database file afterwards, so make sure it doesn't have
+	// changes which would be lost
+	if _, err = os.Stat(db); err == nil && !*pullForce {
+		changed, err := dbChanged(db, localMeta)
+		if err != nil {
+			return false, err
+		}
+		if changed {
+			return false, fmt.Errorf("%s has been changed since the last commit.  Use --force if you really want "+
+				"to overwrite it", db)
+		}
+	}
+
+	// Copy across the remote commits, as they're needed either way
+	copyHistory(localMeta.Commits, remoteMeta, remoteBranch.Commit)
+
+	// With --merge, create a merge commit with the local head as its first parent and the remote head as the other
+	// one.  Databases are stored whole, so like 'dio merge' it uses the database being merged in (the remote one)
+	if pullCmdMerge {
+		authorName := viper.GetString("user.name")
+		authorEmail := viper.GetString("user.email")
+		if authorName == "" || authorEmail == "" {
+			return false, errors.New("Author name and email addresses are required!")
+		}
+		newCom := commitEntry{
+			AuthorName:     authorName,
+			AuthorEmail:    authorEmail,
+			CommitterName:  authorName,
+			CommitterEmail: authorEmail,
+			Message:        fmt.Sprintf("Merge remote branch '%s'", branch),
+			OtherParents:   []string{remoteBranch.Commit},
+			Parent:         localBranch.Commit,
+			Timestamp:      time.Now().UTC(),
+			Tree:           remoteMeta.Commits[remoteBranch.Commit].Tree,
+		}
+		newCom.ID = createCommitID(newCom)
+		localMeta.Commits[newCom.ID] = newCom
+		localMeta.Branches[branch] = branchEntry{
+			Commit:      newCom.ID,
+			CommitCount: localBranch.CommitCount + 1,
+			Description: localBranch.Description,
+		}
+		_, err = fmt.Fprintf(fOut, "  * Merge commit %s created.  Use 'dio push' to send it to the server\n",
+			newCom.ID)
+		if err != nil {
+			return false, err
+		}
+		return true, saveMetadata(db, localMeta)
+	}
+
+	// Otherwise replace the local branch with the remote one
+	localMeta.Branches[branch] = remoteBranch
+	_, err = fmt.Fprintf(fOut, "  * Local branch '%s' overwritten with the remote branch\n", branch)
+	if err != nil {
+		return false, err
+	}
+	return true, saveMetadata(db, localMeta)
+}
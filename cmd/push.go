@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -11,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	rq "github.com/parnurzeal/gorequest"
@@ -20,15 +22,17 @@ import (
 )
 
 var (
-	pushCmdBranch, pushCmdCommit, pushCmdDB  string
-	pushCmdEmail, pushCmdLicence, pushCmdMsg string
-	pushCmdName, pushCmdTimestamp            string
-	pushCmdForce, pushCmdPublic              bool
+	pushCmdBranch, pushCmdCommit, pushCmdDB    string
+	pushCmdEmail, pushCmdLicence, pushCmdMsg   string
+	pushCmdName, pushCmdTimestamp              string
+	pushCmdDryRun, pushCmdForce, pushCmdPublic bool
+	pushCmdAllowEmpty, pushCmdNoEdit           bool
+	pushCmdQuiet, pushCmdSign                  bool
 )
 
 // Uploads a database to DBHub.io.
 var pushCmd = &cobra.Command{
-	Use:   "push [database file]",
+	Use:   "push [database file]...",
 	Short: "Upload a database",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return push(args)
@@ -37,28 +41,43 @@ var pushCmd = &cobra.Command{
 
 func init() {
 	RootCmd.AddCommand(pushCmd)
+	pushCmd.Flags().BoolVar(&pushCmdAllowEmpty, "allow-empty", false,
+		"Upload the database even if it's unchanged from the head of the branch")
 	pushCmd.Flags().StringVar(&pushCmdName, "author", "", "Author name")
 	pushCmd.Flags().StringVar(&pushCmdBranch, "branch", "",
 		"Remote branch the database will be uploaded to")
 	pushCmd.Flags().StringVar(&pushCmdCommit, "commit", "",
 		"ID of the previous commit, for appending this new database to")
 	pushCmd.Flags().StringVar(&pushCmdDB, "dbname", "", "Override for the database name")
+	pushCmd.Flags().BoolVar(&pushCmdDryRun, "dry-run", false,
+		"Show what would be uploaded, without sending anything")
 	pushCmd.Flags().StringVar(&pushCmdEmail, "email", "", "Email address of the author")
 	pushCmd.Flags().BoolVar(&pushCmdForce, "force", false, "Overwrite existing commit history?")
 	pushCmd.Flags().StringVar(&pushCmdLicence, "licence", "",
 		"The licence (ID) for the database, as per 'dio licence list'")
 	pushCmd.Flags().StringVar(&pushCmdMsg, "message", "",
-		"(Required) Commit message for this upload")
+		"Commit message for this upload.  If not given, an editor is opened to write one")
+	pushCmd.Flags().BoolVar(&pushCmdNoEdit, "no-edit", false,
+		"Don't open an editor for the commit message when --message isn't given")
 	pushCmd.Flags().BoolVar(&pushCmdPublic, "public", false, "Should the database be public?")
+	pushCmd.Flags().BoolVar(&pushCmdQuiet, "quiet", false, "Don't display the upload progress bar")
+	pushCmd.Flags().BoolVar(&pushCmdSign, "sign", false,
+		"Sign any unsigned commits being pushed, with the private key of your client certificate")
 	pushCmd.Flags().StringVar(&pushCmdTimestamp, "timestamp", "", "Timestamp to use as the commit date")
 }
 
 func push(args []string) error {
+	// Pick the nonce for the upload idempotency keys of this push
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	pushNonce = hex.EncodeToString(b)
+
 	// Ensure a database file was given
-	var db string
-	var err error
-	if len(args) == 0 {
-		db, err = getDefaultDatabase()
+	switch len(args) {
+	case 0:
+		db, err := getDefaultDatabase()
 		if err != nil {
 			return err
 		}
@@ -66,20 +85,77 @@ func push(args []string) error {
 			// No database name was given on the command line, and we don't have a default database selected
 			return errors.New("No database file specified")
 		}
-	} else {
-		db = args[0]
+		return pushDatabase(db)
+	case 1:
+		return pushDatabase(args[0])
+	}
+
+	// * Multiple database files were given, so push them one after the other *
+
+	// There's no sensible way to apply a database name override to several databases
+	if pushCmdDB != "" {
+		return errors.New("The --dbname option can't be used when pushing more than one database")
 	}
-	// TODO: Allow giving multiple database files on the command line.  Hopefully just needs turning this
-	// TODO  into a for loop
-	if len(args) > 1 {
-		return errors.New("Only one database can be uploaded at a time (for now)")
+
+	// Push each of the databases, carrying on to the next one if a push fails.  The branch name and message are
+	// restored each time, as pushing a database fills them in (with the active branch, or from the editor) when not
+	// given
+	branch, msg := pushCmdBranch, pushCmdMsg
+	var failed []string
+	pushErrs := make(map[string]error)
+	for _, db := range args {
+		pushCmdBranch = branch
+		pushCmdMsg = msg
+		pushCmdDB = ""
+		err := pushDatabase(db)
+		if err != nil {
+			failed = append(failed, db)
+			pushErrs[db] = err
+		}
 	}
+	pushCmdBranch = branch
+	pushCmdDB = ""
 
+	// Display a summary of the results
+	_, err := fmt.Fprint(fOut, "Push summary:\n\n")
+	if err != nil {
+		return err
+	}
+	for _, db := range args {
+		if e, ok := pushErrs[db]; ok {
+			_, err = fmt.Fprintf(fOut, "  * %s: failed - %s\n", db, e)
+		} else {
+			_, err = fmt.Fprintf(fOut, "  * %s: pushed\n", db)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintln(fOut)
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d databases failed to push: %s", len(failed), len(args),
+			strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Uploads a single database to DBHub.io
+func pushDatabase(db string) error {
 	// Ensure the database file exists
 	fi, err := os.Stat(db)
 	if err != nil {
 		return err
 	}
+	err = checkSQLiteHeader(db)
+	if err != nil {
+		return err
+	}
+
+	// The server generates the commit ID from the message, so it's normalised the same way as local commits
+	pushCmdMsg = normaliseMessage(pushCmdMsg)
 
 	// Grab author name & email from the dio config file, but allow command line flags to override them
 	var committerName, committerEmail, pushAuthor, pushEmail string
@@ -91,7 +167,7 @@ func push(args []string) error {
 	v, ok := viper.Get("user.email").(string)
 	if ok {
 		pushEmail = v
-		committerEmail = u
+		committerEmail = v
 	}
 	if pushCmdName != "" {
 		pushAuthor = pushCmdName
@@ -105,6 +181,14 @@ func push(args []string) error {
 		return errors.New("Both author name and email are required!")
 	}
 
+	// If a timestamp was provided, make sure it's sensible before sending it to the server
+	if pushCmdTimestamp != "" {
+		_, err = checkCommitTime(pushCmdTimestamp)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Determine name to store database as
 	if pushCmdDB == "" {
 		pushCmdDB = filepath.Base(db)
@@ -133,6 +217,11 @@ func push(args []string) error {
 			return errors.New(fmt.Sprintf("That branch ('%s') doesn't exist", pushCmdBranch))
 		}
 
+		// Protected branches can't have their history overwritten
+		if pushCmdForce && isProtected(meta, pushCmdBranch) {
+			return pushProtected()
+		}
+
 		// Build a list of the commits in the local branch
 		localCommitList := []string{localHead.Commit}
 		c, ok := meta.Commits[localHead.Commit]
@@ -152,11 +241,14 @@ func push(args []string) error {
 		if err != nil {
 			return err
 		}
+		if pushCmdDryRun {
+			return pushDryRunExisting(meta, newMeta, found, localCommitList)
+		}
 		if !found {
 			// The database only exists locally, so we use the first commit to create the remote database,
 			// then loop around pushing the remaining commits
 			newCommit := meta.Commits[localCommitList[len(localCommitList)-1]].ID
-			err = sendCommit(meta, db, dbURL, newCommit, pushCmdPublic)
+			err = sendCommit(meta, db, dbURL, newCommit, "", pushCmdPublic)
 			if err != nil {
 				return err
 			}
@@ -255,7 +347,7 @@ func push(args []string) error {
 
 			// Create the new (forked) branch on DBHub.io
 			newCommit := localCommitList[localCommitLength-baseBranchCounter]
-			err = sendCommit(meta, db, dbURL, newCommit, pushCmdPublic)
+			err = sendCommit(meta, db, dbURL, newCommit, "", pushCmdPublic)
 			if err != nil {
 				return err
 			}
@@ -372,7 +464,7 @@ func push(args []string) error {
 
 		// Send the commits to the cloud
 		for _, commitID := range pushCommits {
-			err = sendCommit(meta, db, dbURL, commitID, pushCmdPublic)
+			err = sendCommit(meta, db, dbURL, commitID, meta.Commits[commitID].Parent, pushCmdPublic)
 			if err != nil {
 				return err
 			}
@@ -385,6 +477,10 @@ func push(args []string) error {
 	// database remotely (if it's not there already) and creates the local metadata.
 	// If the database already exists remotely, this code will fail.
 	// TODO: Maybe add a nicer failure message here for when local metadata is missing but the db exists remotely?
+	if pushCmdSign {
+		return errors.New("Only commits in the local metadata can be signed.  Use 'dio commit --sign' to create " +
+			"a signed commit first")
+	}
 	z, ok := viper.Get("user.name").(string)
 	if !ok {
 		return fmt.Errorf("Committer name could not be determined")
@@ -402,8 +498,44 @@ func push(args []string) error {
 	}
 	s := sha256.Sum256(b)
 	shaSum := hex.EncodeToString(s[:])
-	req := rq.New().TLSClientConfig(&TLSConfig).Post(dbURL).
+	if pushCmdDryRun {
+		e := dbTreeEntry{
+			EntryType:    DATABASE,
+			LastModified: fi.ModTime().Truncate(time.Second).UTC(),
+			Name:         pushCmdDB,
+			Sha256:       shaSum,
+			Size:         fi.Size(),
+		}
+		com := commitEntry{
+			AuthorEmail:    pushEmail,
+			AuthorName:     pushAuthor,
+			CommitterEmail: committerEmail,
+			CommitterName:  committerName,
+			Message:        pushCmdMsg,
+			Parent:         pushCmdCommit,
+		}
+		return pushDryRunNew(e, com)
+	}
+
+	// If no message was given on the command line, open an editor for the user to write one
+	if pushCmdMsg == "" && !pushCmdNoEdit {
+		branch := pushCmdBranch
+		if branch == "" {
+			branch = "(the default branch)"
+		}
+		pushCmdMsg, err = editMessage(pushCmdDB, branch, "",
+			[]string{numFormat.Sprintf("upload: %s (%d bytes)", db, fi.Size())})
+		if err != nil {
+			return err
+		}
+	}
+	client, err := newTLSClient()
+	if err != nil {
+		return err
+	}
+	req := client.Post(dbURL).
 		Type("multipart").
+		Query(fmt.Sprintf("allowempty=%v", pushCmdAllowEmpty)).
 		Query(fmt.Sprintf("authoremail=%s", url.QueryEscape(pushEmail))).
 		Query(fmt.Sprintf("authorname=%s", url.QueryEscape(pushAuthor))).
 		Query(fmt.Sprintf("branch=%s", url.QueryEscape(pushCmdBranch))).
@@ -421,14 +553,25 @@ func push(args []string) error {
 	if pushCmdLicence != "" {
 		req.Query(fmt.Sprintf("licence=%s", url.QueryEscape(pushCmdLicence)))
 	}
-	resp, _, errs := req.End()
+	if pushCmdCommit != "" {
+		req.Set("If-Match", pushCmdCommit)
+	}
+	req.Set("Idempotency-Key", pushIdempotencyKey(pushCmdBranch, pushCmdCommit, shaSum, pushCmdMsg, pushEmail,
+		pushAuthor, pushCmdTimestamp))
+	resp, body, errs := sendWithProgress(withToken(req), fi.Size(), pushCmdQuiet)
 	if errs != nil {
+		if err = timeoutError(errs); err != nil {
+			return err
+		}
 		log.Print("Errors when uploading database to the cloud:")
 		for _, err := range errs {
 			_, _ = fmt.Fprint(fOut, err)
 		}
 		return errors.New("Error when uploading database to the cloud")
 	}
+	if err = pushRejected(resp, body); err != nil {
+		return err
+	}
 	if resp != nil && resp.StatusCode != http.StatusCreated {
 		return errors.New(fmt.Sprintf("Upload failed with an error: HTTP status %d - '%v'\n",
 			resp.StatusCode, resp.Status))
@@ -451,7 +594,7 @@ func push(args []string) error {
 	}
 
 	// If the database isn't in the local metadata cache, then copy it there
-	err = ioutil.WriteFile(filepath.Join(".dio", db, "db", shaSum), b, 0644)
+	err = writeFileAtomic(filepath.Join(".dio", db, "db", shaSum), b, 0644)
 	if err != nil {
 		return err
 	}
@@ -492,25 +635,251 @@ func push(args []string) error {
 	return err
 }
 
-// Sends a commit to the cloud
-func sendCommit(meta metaData, db string, dbURL string, newCommit string, public bool) (err error) {
+// Returns the error for when the server has rejected an upload, because the branch head isn't the one we expected
+func pushBranchMoved() error {
+	return fmt.Errorf("The %s on %s has moved since it was last retrieved.  Pull first, then push again",
+		pushBranchName(), cloud)
+}
+
+// Returns how the branch being pushed to is named in messages.  Without --branch, the server uses the default
+// branch of the database
+func pushBranchName() string {
+	if pushCmdBranch == "" {
+		return "default branch"
+	}
+	return fmt.Sprintf("branch '%s'", pushCmdBranch)
+}
+
+// Displays what a push of a database with local metadata would send, without sending anything
+func pushDryRunExisting(meta metaData, newMeta metaData, found bool, localCommitList []string) (err error) {
+	// Work out which of the local commits aren't on the remote server yet
+	var pushCommits []string
+	var dest string
+	remoteHead, branchFound := newMeta.Branches[pushCmdBranch]
+	switch {
+	case !found:
+		dest = "new database"
+		pushCommits = localCommitList
+	case !branchFound:
+		dest = "new branch"
+		for _, j := range localCommitList {
+			if _, ok := newMeta.Commits[j]; !ok {
+				pushCommits = append(pushCommits, j)
+			}
+		}
+	default:
+		dest = "existing branch"
+		if !isAncestor(meta, remoteHead.Commit, localCommitList[0]) {
+			return fmt.Errorf("The remote branch '%s' has commits which aren't in the local one.  The push "+
+				"would fail", pushCmdBranch)
+		}
+		for _, j := range localCommitList {
+			if j == remoteHead.Commit {
+				break
+			}
+			pushCommits = append(pushCommits, j)
+		}
+	}
+
+	// Display the plan
+	_, err = fmt.Fprintf(fOut, "Dry run, so nothing will be sent to %s\n\n", cloud)
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(fOut, "  * Name: %s\n", pushCmdDB)
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(fOut, "    Branch: %s (%s)\n", pushCmdBranch, dest)
+	if err != nil {
+		return
+	}
+	if len(pushCommits) == 0 {
+		_, err = fmt.Fprintf(fOut, "    The local and remote branch '%s' are identical.  Nothing to push.\n\n",
+			pushCmdBranch)
+		return
+	}
+	_, err = fmt.Fprintf(fOut, "    Commits to push: %d\n", len(pushCommits))
+	if err != nil {
+		return
+	}
+	for i := len(pushCommits) - 1; i >= 0; i-- {
+		_, err = fmt.Fprintf(fOut, "      %s\n", pushCommits[i])
+		if err != nil {
+			return
+		}
+	}
+	_, err = fmt.Fprintln(fOut)
+	return
+}
+
+// Displays what a push of a database without local metadata would send, including the expected ID of the new commit
+func pushDryRunNew(e dbTreeEntry, com commitEntry) (err error) {
+	// Uploads without a licence are treated as "Not specified"
+	lic := pushCmdLicence
+	if lic == "" {
+		lic = "Not specified"
+	}
+	licList, err := getLicences()
+	if err != nil {
+		return
+	}
+	for i, j := range licList {
+		if strings.ToLower(i) == strings.ToLower(lic) {
+			e.LicenceSHA = j.Sha256
+		}
+	}
+	if e.LicenceSHA == "" {
+		return fmt.Errorf("Unknown licence '%s'.  'dio licence list' shows the available ones", lic)
+	}
+
+	// Generate the commit the same way the server will
+	com.Timestamp = time.Now().UTC()
+	if pushCmdTimestamp != "" {
+		com.Timestamp, err = time.Parse(time.RFC3339, pushCmdTimestamp)
+		if err != nil {
+			return
+		}
+	}
+	com.Tree.Entries = []dbTreeEntry{e}
+	com.Tree.ID = createDBTreeID(com.Tree.Entries)
+	com.ID = createCommitID(com)
+
+	// Display the plan
+	_, err = fmt.Fprintf(fOut, "Dry run, so nothing will be sent to %s\n\n", cloud)
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(fOut, "  * Name: %s (new database)\n", pushCmdDB)
+	if err != nil {
+		return
+	}
+	if pushCmdBranch != "" {
+		_, err = fmt.Fprintf(fOut, "    Branch: %s\n", pushCmdBranch)
+		if err != nil {
+			return
+		}
+	}
+	_, err = fmt.Fprintf(fOut, "    Licence: %s\n", lic)
+	if err != nil {
+		return
+	}
+	_, err = numFormat.Fprintf(fOut, "    Size: %d bytes\n", e.Size)
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(fOut, "    SHA256: %s\n", e.Sha256)
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(fOut, "    Expected commit ID: %s\n", com.ID)
+	if err != nil {
+		return
+	}
+	if com.Message == "" {
+		_, err = fmt.Fprintln(fOut, "    Commit message: (none given)")
+	} else {
+		_, err = fmt.Fprintf(fOut, "    Commit message: %s\n", commitSubject(com))
+	}
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintln(fOut)
+	return
+}
+
+// A random value picked once each time push runs, and included in the upload idempotency keys
+var pushNonce string
+
+// Generates the Idempotency-Key for uploading a database file as a new commit.  It's derived from the details of the
+// upload and pushNonce, so if the upload is retried after the server already accepted it (eg the connection dropped
+// before the response arrived), the server recognises it instead of adding a second commit.  Running push again
+// gives a new key, so pushing the same database twice on purpose isn't mistaken for a retry
+func pushIdempotencyKey(details ...string) string {
+	s := sha256.Sum256([]byte(strings.Join(append(details, pushNonce), "\x00")))
+	return hex.EncodeToString(s[:])
+}
+
+// Returns the error for a push which would move the head of a protected branch to a commit that isn't its descendant
+func pushProtected() error {
+	return fmt.Errorf("The %s is protected, so it can only be updated with commits which build on its current head",
+		pushBranchName())
+}
+
+// Returns the error for an upload the server rejected for a reason with its own message, or nil for any other
+// response.  Those are left to the generic error for the HTTP status
+func pushRejected(resp rq.Response, body string) error {
+	if resp == nil {
+		return nil
+	}
+	switch resp.StatusCode {
+	case http.StatusPreconditionFailed:
+		return pushBranchMoved()
+	case http.StatusRequestEntityTooLarge:
+		return pushTooLarge(body)
+	case http.StatusForbidden:
+		// The server also returns this for authentication and permission failures, so check the reason given
+		if strings.Contains(strings.ToLower(body), "protected") {
+			return pushProtected()
+		}
+	case http.StatusConflict:
+		// This is the general conflict status, which also covers diverged history
+		if b := strings.ToLower(body); strings.Contains(b, "no changes") || strings.Contains(b, "unchanged") {
+			return pushUnchanged()
+		}
+	}
+	return nil
+}
+
+// Returns the error for when the server has rejected an upload for being over its size limit
+func pushTooLarge(body string) error {
+	return fmt.Errorf("The database is larger than %s accepts: %s", cloud, strings.TrimSpace(body))
+}
+
+// Returns the error for when the server has rejected an upload for not changing anything
+func pushUnchanged() error {
+	return fmt.Errorf("The database is unchanged from the head of the %s on %s, so there's nothing to push.  "+
+		"Use --allow-empty to push it anyway", pushBranchName(), cloud)
+}
+
+// Sends a commit to the cloud.  If expectedHead is given, the server is asked to only accept the commit if that's
+// still the head of the branch
+func sendCommit(meta metaData, db string, dbURL string, newCommit string, expectedHead string,
+	public bool) (err error) {
 	commitData, ok := meta.Commits[newCommit]
 	if !ok {
 		return fmt.Errorf("Something went wrong.  Could not retrieve data for commit '%s' from"+
 			"local metadata commit list.", newCommit)
 	}
 	shaSum := commitData.Tree.Entries[0].Sha256
+	if pushCmdSign && commitData.Signature == "" {
+		commitData.Signature, commitData.SigningKeyID, err = signCommit(commitData)
+		if err != nil {
+			return
+		}
+	}
+	// Commits which don't change anything were created deliberately (with commit --allow-empty), so the server is
+	// told to accept them
+	allowEmpty := pushCmdAllowEmpty
+	if p, ok := meta.Commits[commitData.Parent]; ok && p.Tree.ID == commitData.Tree.ID {
+		allowEmpty = true
+	}
 	var otherParents string
 	for i, j := range commitData.OtherParents {
-		if i != 1 {
+		if i != 0 {
 			otherParents += ","
 		}
 		otherParents += j
 	}
 
 	// Push the first commit to the remote cloud, to create the database there
-	req := rq.New().TLSClientConfig(&TLSConfig).Post(dbURL).
+	client, err := newTLSClient()
+	if err != nil {
+		return
+	}
+	req := client.Post(dbURL).
 		Type("multipart").
+		Query(fmt.Sprintf("allowempty=%v", allowEmpty)).
 		Query(fmt.Sprintf("branch=%s", url.QueryEscape(pushCmdBranch))).
 		Query(fmt.Sprintf("commitmsg=%s", url.QueryEscape(commitData.Message))).
 		Query(fmt.Sprintf("lastmodified=%s",
@@ -530,14 +899,30 @@ func sendCommit(meta metaData, db string, dbURL string, newCommit string, public
 	if pushCmdLicence != "" {
 		req.Query(fmt.Sprintf("licence=%s", url.QueryEscape(pushCmdLicence)))
 	}
-	resp, body, errs := req.End()
+	if commitData.Signature != "" {
+		req.Query(fmt.Sprintf("signature=%s", url.QueryEscape(commitData.Signature))).
+			Query(fmt.Sprintf("signingkeyid=%s", url.QueryEscape(commitData.SigningKeyID)))
+	}
+	if expectedHead != "" {
+		req.Set("If-Match", expectedHead)
+	}
+
+	// The commit ID already identifies this exact commit, so it doubles as the key for spotting retried uploads
+	req.Set("Idempotency-Key", commitData.ID)
+	resp, body, errs := sendWithProgress(withToken(req), commitData.Tree.Entries[0].Size, pushCmdQuiet)
 	if errs != nil {
+		if err = timeoutError(errs); err != nil {
+			return
+		}
 		e := fmt.Sprintln("Errors when uploading database to the cloud:")
 		for _, err := range errs {
 			e = err.Error()
 		}
 		return errors.New(e)
 	}
+	if err = pushRejected(resp, body); err != nil {
+		return
+	}
 	if resp != nil && resp.StatusCode != http.StatusCreated {
 		return errors.New(fmt.Sprintf("Upload failed with an error: '%v'", body))
 	}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Displays the record of where the head of a branch has been
+var reflogCmd = &cobra.Command{
+	Use:   "reflog [database name] [branch name]",
+	Short: "Display each time the head of a branch moved",
+	Long: `Displays the reflog of a branch, which records each time its head commit was changed (eg by commit,
+pull, branch revert, or squash), newest first.  The entries are numbered as branch@{n}, which can be given to
+'dio reset --to' to move the branch back to where it was.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return reflog(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(reflogCmd)
+}
+
+func reflog(args []string) error {
+	// Ensure a database file was given
+	var db string
+	var err error
+	if len(args) == 0 {
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+	} else {
+		db = args[0]
+	}
+	if len(args) > 2 {
+		return errors.New("Only one branch can be shown at a time (for now)")
+	}
+
+	// Load the metadata, to find the active branch
+	meta, err := loadMetadata(db)
+	if err != nil {
+		return err
+	}
+	branch := meta.ActiveBranch
+	if len(args) == 2 {
+		branch = args[1]
+	}
+	entries, err := reflogRead(db, branch)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		_, err = fmt.Fprintf(fOut, "No reflog entries for branch '%s'\n", branch)
+		return err
+	}
+
+	// Display the entries
+	_, err = fmt.Fprintf(fOut, "Reflog for branch '%s' of %s:\n\n", branch, db)
+	if err != nil {
+		return err
+	}
+	for i, e := range entries {
+		action := e.Action
+		if action == "" {
+			action = "unknown"
+		}
+		_, err = fmt.Fprintf(fOut, "  * %s@{%d}: %s\n", branch, i, e.NewCommit)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(fOut, "    Action: %s\n", action)
+		if err != nil {
+			return err
+		}
+		if e.OldCommit != "" {
+			_, err = fmt.Fprintf(fOut, "    Moved from: %s\n", e.OldCommit)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(fOut, "    Date: %s\n\n", e.Timestamp.Local().Format(time.RFC1123))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var releaseListShort bool
+
 // Displays the list of releases for a remote database
 var releaseListCmd = &cobra.Command{
 	Use:   "releases [database name]",
@@ -20,6 +22,7 @@ var releaseListCmd = &cobra.Command{
 
 func init() {
 	RootCmd.AddCommand(releaseListCmd)
+	releaseListCmd.Flags().BoolVar(&releaseListShort, "short", false, "Display commit IDs in short form")
 }
 
 func releaseList(args []string) error {
@@ -68,7 +71,11 @@ func releaseList(args []string) error {
 		return err
 	}
 	for _, i := range sortedKeys {
-		_, err = fmt.Fprintf(fOut, "  * '%s' : commit %s\n\n", i, meta.Releases[i].Commit)
+		commitID := meta.Releases[i].Commit
+		if releaseListShort {
+			commitID = shortID(commitID)
+		}
+		_, err = fmt.Fprintf(fOut, "  * '%s' : commit %s\n\n", i, commitID)
 		if err != nil {
 			return err
 		}
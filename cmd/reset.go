@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	resetCmdTo    string
+	resetCmdForce bool
+)
+
+// Reflog entries are given as branch@{n}, or just n for the active branch
+var reflogEntryRef = regexp.MustCompile(`^(?:(.+)@\{(\d+)\}|(\d+))$`)
+
+// Moves the head of a branch back to where the reflog says it was
+var resetCmd = &cobra.Command{
+	Use:   "reset [database name] --to branch@{n}",
+	Short: "Move the head of a branch back to a commit from its reflog",
+	Long: `Moves the head of a branch to the commit it pointed at in the given reflog entry, as listed by
+'dio reflog'.  This can be used to undo commands which moved the branch unexpectedly.  If the branch is the
+active one, the database file is changed to match too.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return reset(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(resetCmd)
+	resetCmd.Flags().BoolVarP(&resetCmdForce, "force", "f", false, "Overwrite unsaved changes to the database?")
+	resetCmd.Flags().StringVar(&resetCmdTo, "to", "", "Reflog entry to reset to, eg master@{1}")
+}
+
+func reset(args []string) error {
+	// Ensure a database file was given
+	var db string
+	var err error
+	if len(args) == 0 {
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+	} else {
+		db = args[0]
+	}
+	if len(args) > 1 {
+		return errors.New("Only one database can be changed at a time (for now)")
+	}
+	if resetCmdTo == "" {
+		return errors.New("The reflog entry to reset to is needed.  eg --to master@{1}")
+	}
+
+	// Work out which reflog entry was asked for
+	meta, err := loadMetadata(db)
+	if err != nil {
+		return err
+	}
+	m := reflogEntryRef.FindStringSubmatch(resetCmdTo)
+	if m == nil {
+		return fmt.Errorf("'%s' isn't a reflog entry.  They look like master@{1}", resetCmdTo)
+	}
+	branch, num := m[1], m[2]
+	if branch == "" {
+		branch, num = meta.ActiveBranch, m[3]
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return err
+	}
+	head, ok := meta.Branches[branch]
+	if !ok {
+		return fmt.Errorf("That branch ('%s') doesn't exist", branch)
+	}
+	if isProtected(meta, branch) {
+		return fmt.Errorf("Branch '%s' is protected, so its head can't be moved this way", branch)
+	}
+	entries, err := reflogRead(db, branch)
+	if err != nil {
+		return err
+	}
+	if n >= len(entries) {
+		return fmt.Errorf("Branch '%s' only has %d reflog entries", branch, len(entries))
+	}
+	newHead := entries[n].NewCommit
+	c, ok := meta.Commits[newHead]
+	if !ok {
+		return fmt.Errorf("Commit %s is no longer in the local metadata, so the branch can't be reset to it", newHead)
+	}
+	if newHead == head.Commit {
+		_, err = fmt.Fprintf(fOut, "Branch '%s' is already at %s\n", branch, newHead)
+		return err
+	}
+
+	// Unless --force is specified, check whether the file has changed since the last commit, and let the user know
+	active := branch == meta.ActiveBranch
+	if active && !resetCmdForce {
+		changed, err := dbChanged(db, meta)
+		if err != nil {
+			return err
+		}
+		if changed {
+			return fmt.Errorf("%s has been changed since the last commit.  Use --force if you really want to "+
+				"overwrite it", db)
+		}
+	}
+
+	// Count the number of commits in the branch after the reset
+	commitCount := 1
+	for p := c; p.Parent != ""; commitCount++ {
+		p, ok = meta.Commits[p.Parent]
+		if !ok {
+			return fmt.Errorf("Broken commit history: a parent of commit '%s' isn't in the commit list", newHead)
+		}
+	}
+
+	// If it's the active branch, put the database file from the commit in place
+	if active && len(c.Tree.Entries) > 0 {
+		e := c.Tree.Entries[0]
+		err = checkDBCache(db, e.Sha256, newHead)
+		if err != nil {
+			return err
+		}
+		var b []byte
+		b, err = ioutil.ReadFile(filepath.Join(".dio", db, "db", e.Sha256))
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(db, b, 0644)
+		if err != nil {
+			return err
+		}
+		err = os.Chtimes(db, time.Now(), e.LastModified)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Save the updated metadata back to disk
+	if active {
+		meta.CheckedOut = ""
+	}
+	meta.Branches[branch] = branchEntry{
+		Commit:      newHead,
+		CommitCount: commitCount,
+		Description: head.Description,
+	}
+	err = saveMetadata(db, meta)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "Branch '%s' reset to %s\n", branch, newHead)
+	return err
+}
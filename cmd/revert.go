@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var revertCmdBranch, revertCmdMsg string
+
+// Restores a previous version of a database as a new commit, keeping the existing history
+var revertCmd = &cobra.Command{
+	Use:   "revert [database name] [commit]",
+	Short: "Create a new commit restoring the database from an earlier commit",
+	Long: `Creates a new commit on the branch containing the database from an earlier commit.  Unlike
+'dio branch revert', the commits after it are kept in the history.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return revert(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(revertCmd)
+	revertCmd.Flags().StringVar(&revertCmdBranch, "branch", "",
+		"Branch to add the new commit to.  Defaults to the active branch")
+	revertCmd.Flags().StringVar(&revertCmdMsg, "message", "", "Commit message for the new commit")
+}
+
+func revert(args []string) error {
+	// Ensure a commit was given, with an optional database name
+	var db, target string
+	var err error
+	switch len(args) {
+	case 1:
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+		target = args[0]
+	case 2:
+		db, target = args[0], args[1]
+	default:
+		return errors.New("The commit to revert to is needed")
+	}
+
+	// Load the metadata
+	meta, err := loadMetadata(db)
+	if err != nil {
+		return err
+	}
+	if revertCmdBranch == "" {
+		revertCmdBranch = meta.ActiveBranch
+	}
+	head, ok := meta.Branches[revertCmdBranch]
+	if !ok {
+		return fmt.Errorf("That branch ('%s') doesn't exist", revertCmdBranch)
+	}
+
+	// The commit being reverted to needs to be in the history of the branch
+	targetCommit, err := resolveCommit(meta, target)
+	if err != nil {
+		return err
+	}
+	if targetCommit.ID == head.Commit {
+		return fmt.Errorf("Branch '%s' is already at commit %s.  Nothing to revert", revertCmdBranch,
+			targetCommit.ID)
+	}
+	if !isAncestor(meta, targetCommit.ID, head.Commit) {
+		return fmt.Errorf("Commit %s isn't in the history of branch '%s'", targetCommit.ID, revertCmdBranch)
+	}
+	if len(targetCommit.Tree.Entries) == 0 {
+		return errors.New("Something has gone wrong.  The commit to revert to has no database in it")
+	}
+	entry := targetCommit.Tree.Entries[0]
+
+	// If the branch is checked out, don't overwrite any uncommitted changes to the database file
+	if revertCmdBranch == meta.ActiveBranch {
+		if _, err = os.Stat(db); err == nil {
+			changed, err := dbChanged(db, meta)
+			if err != nil {
+				return err
+			}
+			if changed {
+				return fmt.Errorf("%s has been changed since the last commit.  Please commit your changes "+
+					"before reverting", db)
+			}
+		}
+	}
+
+	// Make sure the database from the target commit is available locally
+	err = checkDBCache(db, entry.Sha256, targetCommit.ID)
+	if err != nil {
+		return err
+	}
+
+	// Create the new commit, using the tree of the target commit
+	authorName := viper.GetString("user.name")
+	authorEmail := viper.GetString("user.email")
+	if authorName == "" || authorEmail == "" {
+		return errors.New("Author name and email addresses are required!")
+	}
+	revertCmdMsg = normaliseMessage(revertCmdMsg)
+	if revertCmdMsg == "" {
+		revertCmdMsg = fmt.Sprintf("Revert to commit %s", shortID(targetCommit.ID))
+	}
+	newCom := commitEntry{
+		AuthorName:     authorName,
+		AuthorEmail:    authorEmail,
+		CommitterName:  authorName,
+		CommitterEmail: authorEmail,
+		Message:        revertCmdMsg,
+		Parent:         head.Commit,
+		Timestamp:      time.Now().UTC(),
+		Tree:           targetCommit.Tree,
+	}
+	newCom.ID = createCommitID(newCom)
+	meta.Commits[newCom.ID] = newCom
+	meta.Branches[revertCmdBranch] = branchEntry{
+		Commit:      newCom.ID,
+		CommitCount: head.CommitCount + 1,
+		Description: head.Description,
+	}
+
+	// The database file is updated below to match the new head, if it's the active branch
+	if revertCmdBranch == meta.ActiveBranch {
+		meta.CheckedOut = ""
+	}
+
+	// Save the updated metadata back to disk
+	err = saveMetadata(db, meta)
+	if err != nil {
+		return err
+	}
+
+	// If the branch is checked out, update the database file to match the new head
+	if revertCmdBranch == meta.ActiveBranch {
+		b, err := ioutil.ReadFile(filepath.Join(".dio", db, "db", entry.Sha256))
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(db, b, 0644)
+		if err != nil {
+			return err
+		}
+		err = os.Chtimes(db, time.Now(), entry.LastModified)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(fOut, "Branch '%s' reverted to commit %s\n", revertCmdBranch, targetCommit.ID)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * New commit: %s\n", newCom.ID)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(fOut, "    Use 'dio push' to send it to the server")
+	return err
+}
@@ -2,13 +2,13 @@ package cmd
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
@@ -21,11 +21,19 @@ const (
 )
 
 var (
+	apiToken       string
+	cacheDir       string
+	caCertFile     string
+	certFile       string
 	certUser       string
 	cfgFile, cloud string
+	debugOut       = io.Writer(os.Stderr)
 	fOut           = io.Writer(os.Stdout)
 	numFormat      *message.Printer
+	reflogAction   string
+	timeout        time.Duration
 	TLSConfig      tls.Config
+	verbose        bool
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -38,6 +46,10 @@ With dio you can send and receive database files to a DBHub.io cloud,
 and manipulate its tags and branches.`,
 	SilenceErrors: true,
 	SilenceUsage:  true,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Remember which command is running, so any branch heads it moves are recorded with it in the reflog
+		reflogAction = strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+	},
 }
 
 // Execute adds all child commands to the root command & sets flags appropriately.
@@ -57,9 +69,26 @@ func init() {
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "",
 		fmt.Sprintf("config file (default is %s)", filepath.Join("$HOME", ".dio", "config.toml")))
 	RootCmd.PersistentFlags().StringVar(&cloud, "cloud", "https://db4s.dbhub.io",
-		"Address of the DBHub.io cloud")
+		"Address of the DBHub.io cloud.  The same as --server")
+	RootCmd.PersistentFlags().StringVarP(&cloud, "server", "s", "https://db4s.dbhub.io",
+		"Address of the DBHub.io cloud (overrides the DIO_SERVER environment variable and the config file)")
+	RootCmd.PersistentFlags().StringVar(&caCertFile, "cacert", "",
+		"Certificate Authority chain file (overrides the config file)")
+	RootCmd.PersistentFlags().StringVar(&certFile, "cert", "",
+		"DBHub.io client certificate file (overrides the config file)")
+	RootCmd.PersistentFlags().StringVar(&apiToken, "token", "",
+		"API token to send to the DBHub.io cloud, in addition to the client certificate (overrides the config file)")
+	RootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 5*time.Minute,
+		"Maximum time a network request (including the upload or download) can take")
+	RootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false,
+		"Log the HTTP requests sent to the DBHub.io cloud, and its responses.  API tokens aren't shown")
+
+	// Read our configuration data once the command line flags have been parsed
+	cobra.OnInitialize(initConfig)
+}
 
-	// Read all of our configuration data now
+// Reads the configuration file and loads our certificates
+func initConfig() {
 	if cfgFile != "" {
 		// Use config file from the flag
 		viper.SetConfigFile(cfgFile)
@@ -92,61 +121,67 @@ func init() {
 		return
 	}
 
-	// Make sure the paths to our CA Chain and user certificate have been set
-	if found := viper.IsSet("certs.cachain"); found == false {
-		log.Fatal("Path to Certificate Authority chain file not set in the config file")
-		return
+	// Certificate paths given on the command line override the ones in the config file
+	if caCertFile == "" {
+		if found := viper.IsSet("certs.cachain"); found == false {
+			log.Fatal("Path to Certificate Authority chain file not set in the config file")
+			return
+		}
+		caCertFile = viper.GetString("certs.cachain")
 	}
-	if found := viper.IsSet("certs.cert"); found == false {
-		log.Fatal("Path to user certificate file not set in the config file")
-		return
+	if certFile == "" {
+		if found := viper.IsSet("certs.cert"); found == false {
+			log.Fatal("Path to user certificate file not set in the config file")
+			return
+		}
+		certFile = viper.GetString("certs.cert")
 	}
 
-	// If an alternative DBHub.io cloud address is set in the config file, use that
-	if found := viper.IsSet("general.cloud"); found == true {
-		// If the user provided an override on the command line, that will override this anyway
-		cloud = viper.GetString("general.cloud")
-	}
+	// Work out which DBHub.io cloud to talk to
+	cloud = cloudAddress()
 
-	// Read our certificate info, if present
-	ourCAPool := x509.NewCertPool()
-	chainFile, err := ioutil.ReadFile(viper.GetString("certs.cachain"))
-	if err != nil {
-		log.Fatal(err)
-	}
-	ok := ourCAPool.AppendCertsFromPEM(chainFile)
-	if !ok {
-		log.Fatal("Error when loading certificate chain file")
+	// An API token given on the command line overrides the one in the config file
+	if apiToken == "" && viper.IsSet("user.token") {
+		apiToken = viper.GetString("user.token")
 	}
 
-	// TODO: Check if the client certificate file is present
-	certFile := viper.GetString("certs.cert")
-	if _, err = os.Stat(certFile); err != nil {
-		log.Fatalf("Please download your client certificate from DBHub.io, then update the configuration "+
-			"file '%s' with its path", cfgFile)
+	// Downloaded database files are also kept in a cache shared by all of the working directories, so switching
+	// between commits (or cloning the same database again) doesn't need to download them again
+	if home, err := homedir.Dir(); err == nil {
+		cacheDir = filepath.Join(home, ".dio", "cache")
 	}
 
-	// Load a client certificate file
-	cert, err := tls.LoadX509KeyPair(certFile, certFile)
+	// Load our certificates
+	var err error
+	TLSConfig, err = loadTLSConfig(caCertFile, certFile)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Load our self signed CA Cert chain, and set TLS1.2 as minimum
-	TLSConfig = tls.Config{
-		Certificates:             []tls.Certificate{cert},
-		ClientCAs:                ourCAPool,
-		InsecureSkipVerify:       true,
-		MinVersion:               tls.VersionTLS12,
-		PreferServerCipherSuites: true,
-		RootCAs:                  ourCAPool,
-	}
-
-	// Extract the username and email from the TLS certificate
+	// Extract the username and email from the TLS certificate.  The email address is only used if one hasn't been
+	// set in the config file
 	var email string
 	certUser, email, _, err = getUserAndServer()
 	if err != nil {
 		log.Fatal(err)
 	}
-	viper.Set("user.email", email)
+	if !viper.IsSet("user.email") {
+		viper.Set("user.email", email)
+	}
+}
+
+// Returns the address of the DBHub.io cloud to use.  An address given on the command line wins, then the one in the
+// DIO_SERVER environment variable, then the one in the config file.  If none of those are set, the default is used
+func cloudAddress() string {
+	flags := RootCmd.PersistentFlags()
+	if flags.Changed("server") || flags.Changed("cloud") {
+		return cloud
+	}
+	if env := os.Getenv("DIO_SERVER"); env != "" {
+		return env
+	}
+	if viper.IsSet("general.cloud") {
+		return viper.GetString("general.cloud")
+	}
+	return cloud
 }
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var searchCmdBranch string
+var searchCmdIgnoreCase bool
+
+// Finds the commits of a database which match a pattern
+var searchCmd = &cobra.Command{
+	Use:   "search [database name] [pattern]",
+	Short: "Find the commits whose message, author name, or author email match a regular expression",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return search(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(searchCmd)
+	searchCmd.Flags().StringVar(&searchCmdBranch, "branch", "",
+		"Only search the history of this branch.  Defaults to the history of every branch")
+	searchCmd.Flags().BoolVar(&searchCmdIgnoreCase, "ignore-case", false, "Ignore upper/lower case differences")
+}
+
+func search(args []string) error {
+	// Ensure a pattern was given, with an optional database name
+	var db, pattern string
+	var err error
+	switch len(args) {
+	case 1:
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+		pattern = args[0]
+	case 2:
+		db, pattern = args[0], args[1]
+	default:
+		return errors.New("A pattern to search for is needed")
+	}
+	if searchCmdIgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("Invalid search pattern: %s", err)
+	}
+
+	// If there is a local metadata cache for the requested database, use that.  Otherwise, retrieve it from the
+	// server first (without storing it)
+	meta, err := localFetchMetadata(db, true)
+	if err != nil {
+		return err
+	}
+	if len(meta.Branches) == 0 {
+		return fmt.Errorf("No local metadata for '%s' exists, and it's not on %s either", db, cloud)
+	}
+
+	// Only the commits in the history of the branches are searched, as the metadata can also hold ones which were
+	// squashed or reset away
+	var toCheck []string
+	if searchCmdBranch != "" {
+		head, ok := meta.Branches[searchCmdBranch]
+		if !ok {
+			return fmt.Errorf("That branch ('%s') doesn't exist", searchCmdBranch)
+		}
+		toCheck = append(toCheck, head.Commit)
+	} else {
+		for _, head := range meta.Branches {
+			toCheck = append(toCheck, head.Commit)
+		}
+	}
+
+	// Find the matching commits, newest first
+	var found []commitEntry
+	seen := make(map[string]bool)
+	for len(toCheck) > 0 {
+		id := toCheck[0]
+		toCheck = toCheck[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		c, ok := meta.Commits[id]
+		if !ok {
+			continue
+		}
+		if re.MatchString(c.Message) || re.MatchString(c.AuthorName) || re.MatchString(c.AuthorEmail) {
+			found = append(found, c)
+		}
+		if c.Parent != "" {
+			toCheck = append(toCheck, c.Parent)
+		}
+		toCheck = append(toCheck, c.OtherParents...)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		a, b := commitAuthorTime(found[i]), commitAuthorTime(found[j])
+		if a.Equal(b) {
+			return found[i].ID < found[j].ID
+		}
+		return a.After(b)
+	})
+	if len(found) == 0 {
+		_, err = fmt.Fprintf(fOut, "No commits in '%s' match '%s'\n", db, args[len(args)-1])
+		return err
+	}
+
+	// Retrieve the list of known licences, so the commits can be displayed like 'dio log' does
+	l, err := getLicences()
+	if err != nil {
+		return err
+	}
+	licList := make(map[string]string)
+	for _, j := range l {
+		licList[j.Sha256] = j.FullName
+	}
+	_, err = numFormat.Fprintf(fOut, "%d commit(s) in '%s' match '%s':\n\n", len(found), db, args[len(args)-1])
+	if err != nil {
+		return err
+	}
+	for _, c := range found {
+		_, err = fmt.Fprint(fOut, createCommitText(c, licList, false))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
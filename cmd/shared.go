@@ -9,11 +9,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -21,32 +24,210 @@ import (
 
 	"github.com/mitchellh/go-homedir"
 	rq "github.com/parnurzeal/gorequest"
+	"github.com/spf13/viper"
 )
 
-// Check if the database with the given SHA256 checksum is in local cache.  If it's not then download and cache it
-func checkDBCache(db, shaSum string) (err error) {
+// Reads a database file from the shared cache of downloaded databases.  Files which don't match their checksum are
+// removed and treated as not being cached
+func cacheRead(shaSum string) (body []byte, found bool, err error) {
+	if cacheDir == "" {
+		return
+	}
+	body, err = ioutil.ReadFile(filepath.Join(cacheDir, shaSum))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	s := sha256.Sum256(body)
+	if hex.EncodeToString(s[:]) != shaSum {
+		body = nil
+		err = os.Remove(filepath.Join(cacheDir, shaSum))
+		return
+	}
+	found = true
+	return
+}
+
+// Adds a downloaded database file to the shared cache, if it's not already there
+func cacheStore(shaSum string, body []byte) (err error) {
+	if cacheDir == "" {
+		return
+	}
+	if _, err = os.Stat(filepath.Join(cacheDir, shaSum)); err == nil {
+		return
+	}
+	err = os.MkdirAll(cacheDir, 0770)
+	if err != nil {
+		return
+	}
+	return writeFileAtomic(filepath.Join(cacheDir, shaSum), body, 0644)
+}
+
+// Parses a user supplied RFC3339 commit timestamp.  Timestamps more than a day in the future are rejected, so the
+// timestamp option can't be used to make history appear out of order
+func checkCommitTime(ts string) (commitTime time.Time, err error) {
+	commitTime, err = time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return
+	}
+	if commitTime.After(time.Now().Add(24 * time.Hour)) {
+		err = fmt.Errorf("The commit timestamp '%s' is more than a day in the future", ts)
+	}
+	return
+}
+
+// Check if the database with the given SHA256 checksum is in local cache.  If it's not then copy it from the shared
+// cache, or download (the version from the given commit) and cache it
+func checkDBCache(db, shaSum, commit string) (err error) {
 	if _, err = os.Stat(filepath.Join(".dio", db, "db", shaSum)); os.IsNotExist(err) {
+		// Use the shared cache if it has the file, otherwise download it
 		var body []byte
-		_, body, err = retrieveDatabase(db, pullCmdBranch, pullCmdCommit)
+		var found bool
+		body, found, err = cacheRead(shaSum)
 		if err != nil {
 			return
 		}
+		if !found {
+			_, body, err = retrieveDatabase(db, "", commit)
+			if err != nil {
+				return
+			}
 
-		// Verify the SHA256 checksum of the new download
-		s := sha256.Sum256(body)
-		thisSum := hex.EncodeToString(s[:])
-		if thisSum != shaSum {
-			// The newly downloaded database file doesn't have the expected checksum.  Abort.
-			return errors.New(fmt.Sprintf("Aborting: newly downloaded database file should have "+
-				"checksum '%s', but data with checksum '%s' received\n", shaSum, thisSum))
+			// Verify the SHA256 checksum of the new download
+			s := sha256.Sum256(body)
+			thisSum := hex.EncodeToString(s[:])
+			if thisSum != shaSum {
+				// The newly downloaded database file doesn't have the expected checksum.  Abort.
+				return errors.New(fmt.Sprintf("Aborting: newly downloaded database file should have "+
+					"checksum '%s', but data with checksum '%s' received\n", shaSum, thisSum))
+			}
+			err = cacheStore(shaSum, body)
+			if err != nil {
+				return
+			}
 		}
 
 		// Write the database file to disk in the cache directory
-		err = ioutil.WriteFile(filepath.Join(".dio", db, "db", shaSum), body, 0644)
+		err = writeFileAtomic(filepath.Join(".dio", db, "db", shaSum), body, 0644)
 	}
 	return
 }
 
+// Checks the given file starts with the SQLite file header, so empty or non database files aren't committed or
+// uploaded by mistake
+func checkSQLiteHeader(db string) (err error) {
+	f, err := os.Open(db)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	header := make([]byte, 16)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return
+	}
+	if n == 0 {
+		return fmt.Errorf("Aborting: '%s' is empty", db)
+	}
+	if string(header) != "SQLite format 3\000" {
+		return fmt.Errorf("Aborting: '%s' doesn't seem to be an SQLite database", db)
+	}
+	return nil
+}
+
+// Returns the time a commit was authored.  Commits created before the author and committer times were stored
+// separately only have the single Timestamp field
+func commitAuthorTime(c commitEntry) time.Time {
+	if c.AuthorTimestamp.IsZero() {
+		return c.Timestamp
+	}
+	return c.AuthorTimestamp
+}
+
+// Returns the time a commit was committed, falling back to the single Timestamp field for older commits
+func commitCommitterTime(c commitEntry) time.Time {
+	if c.CommitterTimestamp.IsZero() {
+		return c.Timestamp
+	}
+	return c.CommitterTimestamp
+}
+
+// Returns the first line of a commit message, for use where there isn't room for all of it
+func commitSubject(c commitEntry) string {
+	if i := strings.Index(c.Message, "\n"); i >= 0 {
+		return c.Message[:i]
+	}
+	return c.Message
+}
+
+// Returns the most recent commit in the history of both of the given commits, or an empty string if they have no
+// history in common
+func commonAncestor(meta metaData, a string, b string) string {
+	// Collect everything in the history of the first commit
+	seen := make(map[string]bool)
+	toCheck := []string{a}
+	for len(toCheck) > 0 {
+		id := toCheck[0]
+		toCheck = toCheck[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if c, ok := meta.Commits[id]; ok {
+			if c.Parent != "" {
+				toCheck = append(toCheck, c.Parent)
+			}
+			toCheck = append(toCheck, c.OtherParents...)
+		}
+	}
+
+	// Then walk back from the second commit, nearest first, until one of them is reached
+	visited := make(map[string]bool)
+	toCheck = []string{b}
+	for len(toCheck) > 0 {
+		id := toCheck[0]
+		toCheck = toCheck[1:]
+		if seen[id] {
+			return id
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		if c, ok := meta.Commits[id]; ok {
+			if c.Parent != "" {
+				toCheck = append(toCheck, c.Parent)
+			}
+			toCheck = append(toCheck, c.OtherParents...)
+		}
+	}
+	return ""
+}
+
+// Copies the given commit and everything in its history (including the other parents of merge commits) from the
+// metadata into a commit list
+func copyHistory(dst map[string]commitEntry, src metaData, head string) {
+	toCheck := []string{head}
+	for len(toCheck) > 0 {
+		id := toCheck[0]
+		toCheck = toCheck[1:]
+		if _, ok := dst[id]; ok {
+			continue
+		}
+		c, ok := src.Commits[id]
+		if !ok {
+			continue
+		}
+		dst[id] = c
+		if c.Parent != "" {
+			toCheck = append(toCheck, c.Parent)
+		}
+		toCheck = append(toCheck, c.OtherParents...)
+	}
+}
+
 // Generate a stable SHA256 for a commit.
 func createCommitID(c commitEntry) string {
 	var b bytes.Buffer
@@ -58,10 +239,10 @@ func createCommitID(c commitEntry) string {
 		b.WriteString(fmt.Sprintf("parent %s\n", j))
 	}
 	b.WriteString(fmt.Sprintf("author %s <%s> %v\n", c.AuthorName, c.AuthorEmail,
-		c.Timestamp.UTC().Format(time.UnixDate)))
+		commitAuthorTime(c).UTC().Truncate(time.Second).Format(time.UnixDate)))
 	if c.CommitterEmail != "" {
 		b.WriteString(fmt.Sprintf("committer %s <%s> %v\n", c.CommitterName, c.CommitterEmail,
-			c.Timestamp.UTC().Format(time.UnixDate)))
+			commitCommitterTime(c).UTC().Truncate(time.Second).Format(time.UnixDate)))
 	}
 	b.WriteString("\n" + c.Message)
 	b.WriteByte(0)
@@ -72,9 +253,30 @@ func createCommitID(c commitEntry) string {
 // Generate the SHA256 for a tree.
 // Tree entry structure is:
 // * [ entry type ] [ licence sha256] [ file sha256 ] [ file name ] [ last modified (timestamp) ] [ file size (bytes) ]
+// The last modified timestamp is converted to UTC and truncated to whole seconds first, so the ID doesn't depend on
+// the location or precision of the time value.
+// The fields are separated by null bytes, with a newline after the last one.  If any field itself contains a null
+// byte or newline, the entry is instead written as a newline followed by each field as [ byte length ]:[ bytes ].
+// No delimited entry can start with a newline, so the two forms can't be confused.  This keeps the existing IDs for
+// normal names, but does change the tree IDs for names with those characters in them.
 func createDBTreeID(entries []dbTreeEntry) string {
 	var b bytes.Buffer
 	for _, j := range entries {
+		fields := []string{string(j.EntryType), j.LicenceSHA, j.Sha256, j.Name,
+			j.LastModified.UTC().Truncate(time.Second).Format(time.RFC3339), fmt.Sprintf("%d", j.Size)}
+		var lengthPrefix bool
+		for _, f := range fields {
+			if strings.ContainsAny(f, "\x00\n") {
+				lengthPrefix = true
+			}
+		}
+		if lengthPrefix {
+			b.WriteByte('\n')
+			for _, f := range fields {
+				b.WriteString(fmt.Sprintf("%d:%s", len(f), f))
+			}
+			continue
+		}
 		b.WriteString(string(j.EntryType))
 		b.WriteByte(0)
 		b.WriteString(string(j.LicenceSHA))
@@ -83,7 +285,7 @@ func createDBTreeID(entries []dbTreeEntry) string {
 		b.WriteByte(0)
 		b.WriteString(j.Name)
 		b.WriteByte(0)
-		b.WriteString(j.LastModified.Format(time.RFC3339))
+		b.WriteString(j.LastModified.UTC().Truncate(time.Second).Format(time.RFC3339))
 		b.WriteByte(0)
 		b.WriteString(fmt.Sprintf("%d\n", j.Size))
 	}
@@ -93,15 +295,9 @@ func createDBTreeID(entries []dbTreeEntry) string {
 
 // Returns true if a database has been changed on disk since the last commit
 func dbChanged(db string, meta metaData) (changed bool, err error) {
-	// Retrieve the sha256, file size, and last modified date from the head commit of the active branch
-	head, ok := meta.Branches[meta.ActiveBranch]
-	if !ok {
-		err = errors.New("Aborting: info for the active branch isn't found in the local branch cache")
-		return
-	}
-	c, ok := meta.Commits[head.Commit]
-	if !ok {
-		err = errors.New("Aborting: info for the head commit isn't found in the local commit cache")
+	// Retrieve the sha256, file size, and last modified date from the commit the database file came from
+	c, err := workingCommit(meta)
+	if err != nil {
 		return
 	}
 	metaSHASum := c.Tree.Entries[0].Sha256
@@ -149,13 +345,92 @@ func dbChanged(db string, meta metaData) (changed bool, err error) {
 	return
 }
 
+// Opens the user's editor on a commit message template, and returns the message saved from it.  If no starting
+// message is given, the template file set in the config file (if any) is used instead.  Lines starting with '#' are
+// dropped, and an empty message aborts
+func editMessage(db string, branch string, msg string, changes []string) (string, error) {
+	if msg == "" {
+		if tmpl := viper.GetString("user.template"); tmpl != "" {
+			path, err := homedir.Expand(tmpl)
+			if err != nil {
+				return "", err
+			}
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("Couldn't read the commit message template '%s': %s", tmpl, err)
+			}
+			msg = string(b)
+		}
+	}
+
+	// Fill out the template
+	var t strings.Builder
+	if msg != "" {
+		t.WriteString(strings.TrimRight(msg, "\r\n") + "\n")
+	}
+	t.WriteString("\n# Please enter the commit message for the database.  Lines starting with '#' will be ignored,\n" +
+		"# and an empty message aborts the commit.\n#\n")
+	t.WriteString(fmt.Sprintf("# Database: %s\n# Branch: %s\n", db, branch))
+	if len(changes) > 0 {
+		t.WriteString("#\n# Changes:\n")
+		for _, c := range changes {
+			t.WriteString(fmt.Sprintf("#   %s\n", c))
+		}
+	}
+
+	// Write it to a temporary file, and let the user edit it
+	f, err := ioutil.TempFile("", "dio-message-*.txt")
+	if err != nil {
+		return "", err
+	}
+	name := f.Name()
+	defer os.Remove(name)
+	_, err = f.WriteString(t.String())
+	if err != nil {
+		f.Close()
+		return "", err
+	}
+	err = f.Close()
+	if err != nil {
+		return "", err
+	}
+	err = launchEditor(name)
+	if err != nil {
+		return "", err
+	}
+
+	// Read back the saved message, without the comment lines
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, l := range strings.Split(strings.Replace(string(b), "\r\n", "\n", -1), "\n") {
+		if !strings.HasPrefix(l, "#") {
+			lines = append(lines, l)
+		}
+	}
+	msg = normaliseMessage(strings.Join(lines, "\n"))
+	if msg == "" {
+		return "", errors.New("Aborting: the commit message is empty")
+	}
+	return msg, nil
+}
+
 // Retrieves the list of databases available to the user
 var getDatabases = func(url string, user string) (dbList []dbListEntry, err error) {
-	resp, body, errs := rq.New().TLSClientConfig(&TLSConfig).
+	client, err := newTLSClient()
+	if err != nil {
+		return
+	}
+	resp, body, errs := withToken(client.
 		Get(fmt.Sprintf("%s/%s", url, user)).
-		Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION)).
+		Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION))).
 		EndBytes()
 	if errs != nil {
+		if err = timeoutError(errs); err != nil {
+			return
+		}
 		e := fmt.Sprintln("Errors when retrieving the database list:")
 		for _, err := range errs {
 			e += fmt.Sprintf(err.Error())
@@ -194,10 +469,14 @@ func generateConfig(cfgFile string) (err error) {
 	// Download the Certificate Authority chain file
 	caURL := "https://github.com/sqlitebrowser/dio/raw/master/cert/ca-chain.cert.pem"
 	chainFile := filepath.Join(home, ".dio", "ca-chain.cert.pem")
-	resp, body, errs := rq.New().TLSClientConfig(&tls.Config{InsecureSkipVerify: true}).Get(caURL).
+	resp, body, errs := withDebug(rq.New().TLSClientConfig(&tls.Config{InsecureSkipVerify: true}).Timeout(timeout)).
+		Get(caURL).
 		Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION)).
 		EndBytes()
 	if errs != nil {
+		if err = timeoutError(errs); err != nil {
+			return err
+		}
 		e := fmt.Sprintln("errors when retrieving the CA chain file:")
 		for _, errInner := range errs {
 			e += fmt.Sprintf(errInner.Error())
@@ -260,10 +539,17 @@ func getDefaultDatabase() (db string, err error) {
 // Returns a map with the list of licences available on the remote server
 var getLicences = func() (list map[string]licenceEntry, err error) {
 	// Retrieve the database list from the cloud
-	resp, body, errs := rq.New().TLSClientConfig(&TLSConfig).Get(cloud+"/licence/list").
-		Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION)).
+	client, err := newTLSClient()
+	if err != nil {
+		return
+	}
+	resp, body, errs := withToken(client.Get(cloud+"/licence/list").
+		Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION))).
 		End()
 	if errs != nil {
+		if err = timeoutError(errs); err != nil {
+			return
+		}
 		e := fmt.Sprintln("errors when retrieving the licence list:")
 		for _, err := range errs {
 			e += fmt.Sprintf(err.Error())
@@ -317,6 +603,73 @@ func getUserAndServer() (userAcc string, email string, certServer string, err er
 	return
 }
 
+// Returns true if the commit "ancestor" is reachable by following the parent links back from "commit", or is the
+// commit itself
+func isAncestor(meta metaData, ancestor string, commit string) bool {
+	seen := make(map[string]bool)
+	toCheck := []string{commit}
+	for len(toCheck) > 0 {
+		id := toCheck[0]
+		toCheck = toCheck[1:]
+		if id == ancestor {
+			return true
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		c, ok := meta.Commits[id]
+		if !ok {
+			continue
+		}
+		if c.Parent != "" {
+			toCheck = append(toCheck, c.Parent)
+		}
+		toCheck = append(toCheck, c.OtherParents...)
+	}
+	return false
+}
+
+// Returns true if the given branch is protected, meaning its head may only move forward to a descendant commit
+func isProtected(meta metaData, branch string) bool {
+	for _, j := range meta.Protected {
+		if j == branch {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the command line for the user's editor.  The editor is taken from the config file, then the EDITOR
+// environment variable, falling back to vi (or notepad on Windows).  Settings which are only whitespace are skipped
+func editorCommand() []string {
+	for _, editor := range []string{viper.GetString("user.editor"), os.Getenv("EDITOR")} {
+		if args := strings.Fields(editor); len(args) > 0 {
+			return args
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// Runs the user's editor on the given file, and waits for it to finish
+var launchEditor = func(path string) error {
+	args := editorCommand()
+	editor := strings.Join(args, " ")
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("Running the editor '%s' failed: %s.  The commit message can be given with --message "+
+			"instead", editor, err)
+	}
+	return nil
+}
+
 // Loads the local metadata from disk (if present).  If not, then grab it from the remote server, storing it locally.
 //     Note - This is subtly different than calling updateMetadata() itself.  This function
 //     (loadMetadata()) is for use by commands which can use a local metadata cache all by itself
@@ -421,12 +774,7 @@ func mergeMetadata(origMeta metaData, newMeta metaData) (mergedMeta metaData, er
 					// If there are more commits in the local branch than in the remote one, we keep the local branch
 					// as it probably means the user is adding stuff locally (prior to pushing to the server)
 					if localLength > remoteLength {
-						c := origMeta.Commits[brData.Commit]
-						mergedMeta.Commits[c.ID] = origMeta.Commits[c.ID]
-						for c.Parent != "" {
-							c = origMeta.Commits[c.Parent]
-							mergedMeta.Commits[c.ID] = origMeta.Commits[c.ID]
-						}
+						copyHistory(mergedMeta.Commits, origMeta, brData.Commit)
 
 						// Copy the local branch data
 						mergedMeta.Branches[brName] = brData
@@ -457,9 +805,7 @@ func mergeMetadata(origMeta metaData, newMeta metaData) (mergedMeta metaData, er
 							if err != nil {
 								return
 							}
-							for _, j := range remoteList {
-								mergedMeta.Commits[j] = newMeta.Commits[j]
-							}
+							copyHistory(mergedMeta.Commits, newMeta, newData.Commit)
 							mergedMeta.Branches[brName] = newMeta.Branches[brName]
 						} else {
 							// The local and remote branches are the same, so copy the local branch commits across to
@@ -468,9 +814,7 @@ func mergeMetadata(origMeta metaData, newMeta metaData) (mergedMeta metaData, er
 							if err != nil {
 								return
 							}
-							for _, j := range localList {
-								mergedMeta.Commits[j] = origMeta.Commits[j]
-							}
+							copyHistory(mergedMeta.Commits, origMeta, brData.Commit)
 							mergedMeta.Branches[brName] = brData
 						}
 						// No need to do further checks on this branch
@@ -484,13 +828,9 @@ func mergeMetadata(origMeta metaData, newMeta metaData) (mergedMeta metaData, er
 							return
 						}
 
-						// Copy across the commits from the local branch
-						localCommit := origMeta.Commits[brData.Commit]
-						mergedMeta.Commits[localCommit.ID] = origMeta.Commits[localCommit.ID]
-						for localCommit.Parent != "" {
-							localCommit = origMeta.Commits[localCommit.Parent]
-							mergedMeta.Commits[localCommit.ID] = origMeta.Commits[localCommit.ID]
-						}
+						// Copy across the commits from the local branch, including the other parents of any merge
+						// commits
+						copyHistory(mergedMeta.Commits, origMeta, brData.Commit)
 
 						// Copy across the branch data entry for the local branch
 						mergedMeta.Branches[brName] = brData
@@ -514,13 +854,8 @@ func mergeMetadata(origMeta metaData, newMeta metaData) (mergedMeta metaData, er
 				}
 				mergedMeta.Branches[brName] = brData
 
-				// Copy across the commits from the local branch
-				localCommit := origMeta.Commits[brData.Commit]
-				mergedMeta.Commits[localCommit.ID] = origMeta.Commits[localCommit.ID]
-				for localCommit.Parent != "" {
-					localCommit = origMeta.Commits[localCommit.Parent]
-					mergedMeta.Commits[localCommit.ID] = origMeta.Commits[localCommit.ID]
-				}
+				// Copy across the commits from the local branch, including the other parents of any merge commits
+				copyHistory(mergedMeta.Commits, origMeta, brData.Commit)
 
 				// Copy across the branch data entry for the local branch
 				mergedMeta.Branches[brName] = brData
@@ -530,13 +865,8 @@ func mergeMetadata(origMeta metaData, newMeta metaData) (mergedMeta metaData, er
 		// Add new branches
 		for remoteName, remoteData := range newMeta.Branches {
 			if _, ok := origMeta.Branches[remoteName]; ok == false {
-				// Copy their commit data
-				newCommit := newMeta.Commits[remoteData.Commit]
-				mergedMeta.Commits[newCommit.ID] = newMeta.Commits[newCommit.ID]
-				for newCommit.Parent != "" {
-					newCommit = newMeta.Commits[newCommit.Parent]
-					mergedMeta.Commits[newCommit.ID] = newMeta.Commits[newCommit.ID]
-				}
+				// Copy their commit data, including the other parents of any merge commits
+				copyHistory(mergedMeta.Commits, newMeta, remoteData.Commit)
 
 				// Copy their branch data
 				mergedMeta.Branches[remoteName] = remoteData
@@ -591,6 +921,13 @@ func mergeMetadata(origMeta metaData, newMeta metaData) (mergedMeta metaData, er
 		// Copy the default branch name from the remote server
 		mergedMeta.DefBranch = newMeta.DefBranch
 
+		// Keep the branches protected either locally or on the remote server
+		for _, j := range append(origMeta.Protected, newMeta.Protected...) {
+			if _, ok := mergedMeta.Branches[j]; ok && !isProtected(mergedMeta, j) {
+				mergedMeta.Protected = append(mergedMeta.Protected, j)
+			}
+		}
+
 		// If an active (local) branch has been set, then copy it to the merged metadata.  Otherwise use the default
 		// branch as given by the remote server
 		if origMeta.ActiveBranch != "" {
@@ -599,6 +936,11 @@ func mergeMetadata(origMeta metaData, newMeta metaData) (mergedMeta metaData, er
 			mergedMeta.ActiveBranch = newMeta.DefBranch
 		}
 
+		// Keep track of which commit the database file was checked out from
+		if _, ok := mergedMeta.Commits[origMeta.CheckedOut]; ok {
+			mergedMeta.CheckedOut = origMeta.CheckedOut
+		}
+
 		_, err = fmt.Fprintln(fOut)
 		if err != nil {
 			return
@@ -613,10 +955,172 @@ func mergeMetadata(origMeta metaData, newMeta metaData) (mergedMeta metaData, er
 	return
 }
 
+// Tidies up a commit message before it's used in a new commit, so messages which look the same also give the same
+// commit ID.  Windows (CRLF) and old Mac (CR) line endings are changed to new lines, trailing white space is removed
+// from each line, and leading and trailing blank lines are dropped.  Messages inside existing commits are left alone,
+// as changing them would change the commit IDs
+func normaliseMessage(msg string) string {
+	msg = strings.Replace(msg, "\r\n", "\n", -1)
+	msg = strings.Replace(msg, "\r", "\n", -1)
+	lines := strings.Split(msg, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// Adds an entry to the reflog of a branch, which records each time its head moved
+func reflogAppend(db string, branch string, entry reflogEntry) (err error) {
+	err = os.MkdirAll(filepath.Join(".dio", db, "logs"), 0770)
+	if err != nil {
+		return
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(".dio", db, "logs", url.PathEscape(branch)),
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	_, err = f.Write(append(b, '\n'))
+	if errInner := f.Close(); err == nil {
+		err = errInner
+	}
+	return
+}
+
+// Returns the commits mentioned in the reflogs of all branches of a database, including branches which have since
+// been removed.  Entries made before the since time are skipped
+func reflogCommits(db string, since time.Time) (ids []string, err error) {
+	files, err := ioutil.ReadDir(filepath.Join(".dio", db, "logs"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	for _, f := range files {
+		branch, err := url.PathUnescape(f.Name())
+		if err != nil || f.IsDir() {
+			continue
+		}
+		entries, err := reflogRead(db, branch)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Timestamp.Before(since) {
+				continue
+			}
+			ids = append(ids, e.NewCommit)
+			if e.OldCommit != "" {
+				ids = append(ids, e.OldCommit)
+			}
+		}
+	}
+	return
+}
+
+// Removes the reflog entries made before the given time from the reflogs of all branches of a database.  Reflogs
+// left with no entries are deleted
+func reflogExpire(db string, before time.Time) (err error) {
+	files, err := ioutil.ReadDir(filepath.Join(".dio", db, "logs"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	for _, f := range files {
+		branch, errInner := url.PathUnescape(f.Name())
+		if errInner != nil || f.IsDir() {
+			continue
+		}
+		var entries []reflogEntry
+		entries, err = reflogRead(db, branch)
+		if err != nil {
+			return
+		}
+
+		// The entries are read newest first, but stored oldest first
+		var kept []byte
+		expired := false
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i].Timestamp.Before(before) {
+				expired = true
+				continue
+			}
+			var b []byte
+			b, err = json.Marshal(entries[i])
+			if err != nil {
+				return
+			}
+			kept = append(kept, append(b, '\n')...)
+		}
+		if !expired {
+			continue
+		}
+		logFile := filepath.Join(".dio", db, "logs", f.Name())
+		if len(kept) == 0 {
+			err = os.Remove(logFile)
+		} else {
+			err = writeFileAtomic(logFile, kept, 0644)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Reads the reflog of a branch, newest entry first
+func reflogRead(db string, branch string) (entries []reflogEntry, err error) {
+	b, err := ioutil.ReadFile(filepath.Join(".dio", db, "logs", url.PathEscape(branch)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if l == "" {
+			continue
+		}
+		var e reflogEntry
+		err = json.Unmarshal([]byte(l), &e)
+		if err != nil {
+			return nil, fmt.Errorf("The reflog for branch '%s' is corrupt: %s", branch, err)
+		}
+		entries = append([]reflogEntry{e}, entries...)
+	}
+	return
+}
+
+// Looks up a commit by branch name, tag name, or commit ID (in that order)
+func resolveCommit(meta metaData, ref string) (c commitEntry, err error) {
+	id := ref
+	if br, ok := meta.Branches[ref]; ok {
+		id = br.Commit
+	} else if tag, ok := meta.Tags[ref]; ok {
+		id = tag.Commit
+	}
+	c, ok := meta.Commits[id]
+	if !ok {
+		err = fmt.Errorf("'%s' isn't a known branch, tag, or commit ID", ref)
+	}
+	return
+}
+
 // Retrieves a database from DBHub.io
 func retrieveDatabase(db string, branch string, commit string) (resp rq.Response, body []byte, err error) {
 	dbURL := fmt.Sprintf("%s/%s/%s", cloud, certUser, db)
-	req := rq.New().TLSClientConfig(&TLSConfig).Get(dbURL).
+	client, err := newTLSClient()
+	if err != nil {
+		return
+	}
+	req := client.Get(dbURL).
 		Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION))
 	if branch != "" {
 		req.Query(fmt.Sprintf("branch=%s", url.QueryEscape(branch)))
@@ -624,8 +1128,11 @@ func retrieveDatabase(db string, branch string, commit string) (resp rq.Response
 		req.Query(fmt.Sprintf("commit=%s", url.QueryEscape(commit)))
 	}
 	var errs []error
-	resp, body, errs = req.EndBytes()
+	resp, body, errs = withToken(req).EndBytes()
 	if errs != nil {
+		if err = timeoutError(errs); err != nil {
+			return
+		}
 		log.Print("Errors when downloading database:")
 		for _, err := range errs {
 			log.Print(err.Error())
@@ -657,14 +1164,21 @@ func retrieveDatabase(db string, branch string, commit string) (resp rq.Response
 // Retrieves database metadata from DBHub.io
 var retrieveMetadata = func(db string) (meta metaData, onCloud bool, err error) {
 	// Download the database metadata
-	resp, md, errs := rq.New().TLSClientConfig(&TLSConfig).Get(cloud+"/metadata/get").
+	client, err := newTLSClient()
+	if err != nil {
+		return metaData{}, false, err
+	}
+	resp, md, errs := withToken(client.Get(cloud+"/metadata/get").
 		Query(fmt.Sprintf("username=%s", url.QueryEscape(certUser))).
 		Query(fmt.Sprintf("folder=%s", "/")).
 		Query(fmt.Sprintf("dbname=%s", url.QueryEscape(db))).
-		Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION)).
+		Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION))).
 		End()
 
 	if errs != nil {
+		if err = timeoutError(errs); err != nil {
+			return metaData{}, false, err
+		}
 		log.Print("Errors when downloading database metadata:")
 		for _, err := range errs {
 			log.Print(err.Error())
@@ -708,7 +1222,7 @@ func saveDefaultDatabase(db string) (err error) {
 	if err != nil {
 		return
 	}
-	err = ioutil.WriteFile(filepath.Join(".dio", "defaults.json"), j, 0644)
+	err = writeFileAtomic(filepath.Join(".dio", "defaults.json"), j, 0644)
 	return
 }
 
@@ -731,10 +1245,58 @@ func saveMetadata(db string, meta metaData) (err error) {
 		return
 	}
 
-	// Write the updated metadata to disk
+	// Keep the existing branch heads, so any which move can be added to the reflog
 	mdFile := filepath.Join(".dio", db, "metadata.json")
-	err = ioutil.WriteFile(mdFile, jsonString, 0644)
-	return err
+	var oldMeta metaData
+	if md, errInner := ioutil.ReadFile(mdFile); errInner == nil {
+		if errInner = json.Unmarshal(md, &oldMeta); errInner != nil {
+			oldMeta = metaData{}
+		}
+	}
+
+	// Write the updated metadata to disk
+	err = writeFileAtomic(mdFile, jsonString, 0644)
+	if err != nil {
+		return
+	}
+	now := time.Now().UTC()
+	for name, br := range meta.Branches {
+		oldHead := oldMeta.Branches[name].Commit
+		if br.Commit == "" || br.Commit == oldHead {
+			continue
+		}
+		err = reflogAppend(db, name, reflogEntry{
+			Action:    reflogAction,
+			NewCommit: br.Commit,
+			OldCommit: oldHead,
+			Timestamp: now,
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Returns the abbreviated form of a commit ID, for display.  Short IDs can be ambiguous, so they're never used for
+// looking up commits
+func shortID(id string) string {
+	if len(id) > 10 {
+		return id[:10]
+	}
+	return id
+}
+
+// Returns a friendlier error if any of the given request errors is from the network timeout being reached, or nil
+// if none are
+func timeoutError(errs []error) error {
+	for _, e := range errs {
+		if netErr, ok := e.(net.Error); ok && netErr.Timeout() {
+			return fmt.Errorf("No response from %s within %v.  The --timeout option can be used to allow more "+
+				"time", cloud, timeout)
+		}
+	}
+	return nil
 }
 
 // Saves metadata to the local cache, merging in with any existing metadata
@@ -766,6 +1328,16 @@ func updateMetadata(db string, saveMeta bool) (mergedMeta metaData, err error) {
 		if err != nil {
 			return
 		}
+
+		// Keep the commits the reflogs point to, so 'dio reset' can still return to earlier branch heads
+		var ids []string
+		ids, err = reflogCommits(db, time.Time{})
+		if err != nil {
+			return
+		}
+		for _, id := range ids {
+			copyHistory(mergedMeta.Commits, origMeta, id)
+		}
 	} else {
 		// No existing metadata, so just copy across the remote metadata
 		mergedMeta = newMeta
@@ -792,7 +1364,56 @@ func updateMetadata(db string, saveMeta bool) (mergedMeta metaData, err error) {
 			}
 		}
 		mdFile := filepath.Join(".dio", db, "metadata.json")
-		err = ioutil.WriteFile(mdFile, []byte(jsonString), 0644)
+		err = writeFileAtomic(mdFile, []byte(jsonString), 0644)
+	}
+	return
+}
+
+// Returns the commit the database file in the working directory came from.  That's the head of the active branch,
+// unless a different commit has been checked out
+func workingCommit(meta metaData) (c commitEntry, err error) {
+	id := meta.CheckedOut
+	if id == "" {
+		head, ok := meta.Branches[meta.ActiveBranch]
+		if !ok {
+			err = errors.New("Aborting: info for the active branch isn't found in the local branch cache")
+			return
+		}
+		id = head.Commit
+	}
+	c, ok := meta.Commits[id]
+	if !ok {
+		err = errors.New("Aborting: info for the head commit isn't found in the local commit cache")
+	}
+	return
+}
+
+// Writes data to a temporary file in the same directory as the destination, then renames it into place.  The
+// rename is atomic on POSIX filesystems, so an interrupted write can't leave a truncated file under a checksum
+// named path in the cache
+func writeFileAtomic(path string, data []byte, perm os.FileMode) (err error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return
+	}
+	err = f.Close()
+	if err != nil {
+		return
+	}
+	err = os.Chmod(f.Name(), perm)
+	if err != nil {
+		return
 	}
+	err = os.Rename(f.Name(), path)
 	return
 }
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var showCmdJSON bool
+
+// Displays everything known about a commit
+var showCmd = &cobra.Command{
+	Use:   "show [database name] [commit]",
+	Short: "Display the full details of a commit, including its files",
+	Long: `Displays the ID, parents, author, committer, and full message of a commit, followed by the files in its
+tree.  The commit can be a commit ID, branch name, or tag name, and defaults to the head of the active branch.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return show(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(showCmd)
+	showCmd.Flags().BoolVar(&showCmdJSON, "json", false, "Display the commit as JSON")
+}
+
+func show(args []string) error {
+	// Ensure a database file was given
+	var db string
+	var err error
+	if len(args) == 0 {
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+	} else {
+		db = args[0]
+	}
+	if len(args) > 2 {
+		return errors.New("Only one commit can be shown at a time (for now)")
+	}
+
+	// If there is a local metadata cache for the requested database, use that.  Otherwise, retrieve it from the
+	// server first (without storing it)
+	meta, err := localFetchMetadata(db, true)
+	if err != nil {
+		return err
+	}
+	if len(meta.Branches) == 0 {
+		return fmt.Errorf("No local metadata for '%s' exists, and it's not on %s either", db, cloud)
+	}
+	ref := meta.ActiveBranch
+	if len(args) == 2 {
+		ref = args[1]
+	}
+	c, err := resolveCommit(meta, ref)
+	if err != nil {
+		return err
+	}
+	if showCmdJSON {
+		return catJSON(c)
+	}
+
+	// Display the commit details
+	_, err = fmt.Fprintf(fOut, "Commit: %s\n\n", c.ID)
+	if err != nil {
+		return err
+	}
+	if c.Parent == "" {
+		_, err = fmt.Fprintln(fOut, "  * Parent: (none)")
+	} else {
+		_, err = fmt.Fprintf(fOut, "  * Parent: %s\n", c.Parent)
+	}
+	if err != nil {
+		return err
+	}
+	for _, p := range c.OtherParents {
+		_, err = fmt.Fprintf(fOut, "  * Merged: %s\n", p)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(fOut, "  * Author: %s <%s>\n", c.AuthorName, c.AuthorEmail)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "    Date: %s\n", commitAuthorTime(c).Local().Format(time.RFC1123))
+	if err != nil {
+		return err
+	}
+	if c.CommitterEmail != "" {
+		_, err = fmt.Fprintf(fOut, "  * Committer: %s <%s>\n", c.CommitterName, c.CommitterEmail)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(fOut, "    Date: %s\n", commitCommitterTime(c).Local().Format(time.RFC1123))
+		if err != nil {
+			return err
+		}
+	}
+	if c.Signature != "" {
+		_, err = fmt.Fprintf(fOut, "  * Signed with key: %s\n", c.SigningKeyID)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(fOut, "  * Tree: %s\n\n", c.Tree.ID)
+	if err != nil {
+		return err
+	}
+	if c.Message != "" {
+		_, err = fmt.Fprintf(fOut, "    %s\n\n", strings.Replace(c.Message, "\n", "\n    ", -1))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Then the files in its tree
+	l, err := getLicences()
+	if err != nil {
+		return err
+	}
+	licList := make(map[string]string)
+	for _, j := range l {
+		licList[j.Sha256] = j.FullName
+	}
+	_, err = fmt.Fprintln(fOut, "Files:")
+	if err != nil {
+		return err
+	}
+	return displayTreeEntries(c.Tree.Entries, licList)
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	squashCmdBranch, squashCmdMsg string
+	squashCmdForce                bool
+)
+
+// Collapses the commits from a given commit up to the head of a branch into a single commit
+var squashCmd = &cobra.Command{
+	Use:   "squash [database name] [base commit]",
+	Short: "Combine the commits from a base commit to the branch head into a single commit",
+	Long: `Replaces the commits from the base commit up to the head of the branch with a single commit.  The new
+commit has the same database as the branch head, and the parent of the base commit as its parent.  As this
+rewrites the history of the branch, --force is needed.  The replaced commits are kept while the reflog entry
+for the squash is, so 'dio reset' can undo it.  'dio gc --prune' removes them once the entry has expired.
+
+dio push can't overwrite the history of a branch on the server yet, so squash commits before pushing them.  If
+they've already been pushed, create a new branch at the squashed commit and push that instead.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return squash(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(squashCmd)
+	squashCmd.Flags().StringVar(&squashCmdBranch, "branch", "",
+		"Branch to squash.  Defaults to the active branch")
+	squashCmd.Flags().BoolVar(&squashCmdForce, "force", false, "Confirm that the branch history should be rewritten")
+	squashCmd.Flags().StringVar(&squashCmdMsg, "message", "",
+		"Commit message for the new commit.  Defaults to the messages of the squashed commits")
+}
+
+func squash(args []string) error {
+	// Ensure a base commit was given, with an optional database name
+	var db, base string
+	var err error
+	switch len(args) {
+	case 1:
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+		base = args[0]
+	case 2:
+		db, base = args[0], args[1]
+	default:
+		return errors.New("The base commit to squash from is needed")
+	}
+
+	// Load the metadata
+	meta, err := loadMetadata(db)
+	if err != nil {
+		return err
+	}
+	if squashCmdBranch == "" {
+		squashCmdBranch = meta.ActiveBranch
+	}
+	head, ok := meta.Branches[squashCmdBranch]
+	if !ok {
+		return fmt.Errorf("That branch ('%s') doesn't exist", squashCmdBranch)
+	}
+	if isProtected(meta, squashCmdBranch) {
+		return fmt.Errorf("Branch '%s' is protected, so its history can't be rewritten", squashCmdBranch)
+	}
+	if !squashCmdForce {
+		return fmt.Errorf("Squashing rewrites the history of branch '%s'.  Use --force if you really want to "+
+			"do this", squashCmdBranch)
+	}
+
+	// Walk back from the branch head to the base commit, collecting the commits to be squashed
+	baseCommit, err := resolveCommit(meta, base)
+	if err != nil {
+		return err
+	}
+	if baseCommit.ID == head.Commit {
+		return errors.New("The base commit is the branch head, so there's nothing to squash")
+	}
+	var squashed []commitEntry
+	c, ok := meta.Commits[head.Commit]
+	if !ok {
+		return errors.New("Something has gone wrong.  Head commit for the branch isn't in the commit list")
+	}
+	for {
+		squashed = append(squashed, c)
+		if c.ID == baseCommit.ID {
+			break
+		}
+		if c.Parent == "" {
+			return fmt.Errorf("Commit %s isn't in the history of branch '%s'", baseCommit.ID, squashCmdBranch)
+		}
+		c, ok = meta.Commits[c.Parent]
+		if !ok {
+			return errors.New("Something has gone wrong.  A parent commit isn't in the commit list")
+		}
+	}
+
+	// Create the new commit.  The author details come from the base commit, as that's where the squashed changes
+	// started, while the committer is whoever is doing the squash.  The server works out commit IDs from a single
+	// timestamp, so the author and committer times are the same
+	committerName := viper.GetString("user.name")
+	committerEmail := viper.GetString("user.email")
+	if committerName == "" || committerEmail == "" {
+		return errors.New("Committer name and email addresses are required!")
+	}
+	if squashCmdMsg == "" {
+		var msgs []string
+		for i := len(squashed) - 1; i >= 0; i-- {
+			msgs = append(msgs, squashed[i].Message)
+		}
+		squashCmdMsg = strings.Join(msgs, "\n\n")
+	}
+	newCom := commitEntry{
+		AuthorEmail:    baseCommit.AuthorEmail,
+		AuthorName:     baseCommit.AuthorName,
+		CommitterEmail: committerEmail,
+		CommitterName:  committerName,
+		Message:        normaliseMessage(squashCmdMsg),
+		Parent:         baseCommit.Parent,
+		Timestamp:      time.Now().UTC(),
+		Tree:           squashed[0].Tree,
+	}
+	newCom.ID = createCommitID(newCom)
+
+	// Point the branch at the new commit.  The squashed commits are left in place, so the squash can be undone
+	// with 'dio reset' until its reflog entry expires and 'dio gc --prune' removes them
+	meta.Commits[newCom.ID] = newCom
+	meta.Branches[squashCmdBranch] = branchEntry{
+		Commit:      newCom.ID,
+		CommitCount: head.CommitCount - len(squashed) + 1,
+		Description: head.Description,
+	}
+
+	// Save the updated metadata back to disk
+	err = saveMetadata(db, meta)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(fOut, "%d commits on branch '%s' squashed into one\n", len(squashed), squashCmdBranch)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * New commit: %s\n", newCom.ID)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(fOut, "    The branch history has been rewritten.  dio push can't overwrite commits which "+
+		"are already on the server")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "    yet, so if they were pushed use 'dio branch create --branch <new name> --commit %s' "+
+		"and push the new branch instead\n", newCom.ID)
+	return err
+}
@@ -3,14 +3,21 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 )
 
+var statusCmdLocal bool
+
 // Displays whether a database has been modified since the last commit
 var statusCmd = &cobra.Command{
 	Use:   "status [database name]",
 	Short: "Displays whether a database has been modified since the last commit",
+	Long: `Displays whether a database has been modified since the last commit.  If there's local metadata for it,
+the active branch is also compared with the same branch on the remote server.  When the server can't be reached a
+warning is shown instead.  Use --local to skip the comparison, eg when working offline.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return status(args)
 	},
@@ -18,6 +25,8 @@ var statusCmd = &cobra.Command{
 
 func init() {
 	RootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().BoolVar(&statusCmdLocal, "local", false,
+		"Only check the local files, without comparing the branch with the remote server")
 }
 
 func status(args []string) error {
@@ -58,11 +67,81 @@ func status(args []string) error {
 	}
 	if changed {
 		_, err = fmt.Fprintf(fOut, "  * '%s': has been changed\n", db)
+	} else {
+		_, err = fmt.Fprintf(fOut, "  * '%s': unchanged\n", db)
+	}
+	if err != nil {
+		return err
+	}
+	if meta.CheckedOut != "" {
+		_, err = fmt.Fprintf(fOut, "    Commit %s is checked out, rather than the head of branch '%s'\n",
+			meta.CheckedOut, meta.ActiveBranch)
 		if err != nil {
 			return err
 		}
+	}
+
+	// If we have local metadata, compare the local branch with the remote one.  That needs the server, so it can be
+	// skipped with --local when working offline
+	if statusCmdLocal {
+		return nil
+	}
+	if _, err = os.Stat(filepath.Join(".dio", db, "metadata.json")); err != nil {
+		return nil
+	}
+	return statusRemote(db, meta)
+}
+
+// Displays whether the active branch is ahead of, behind, or has diverged from the same branch on the remote server
+func statusRemote(db string, meta metaData) error {
+	branch := meta.ActiveBranch
+	localBranch, ok := meta.Branches[branch]
+	if !ok {
 		return nil
 	}
-	_, err = fmt.Fprintf(fOut, "  * '%s': unchanged\n", db)
+
+	// Not being able to reach the server shouldn't stop the local status from being useful, so just mention it
+	remoteMeta, onCloud, err := retrieveMetadata(db)
+	if err != nil {
+		_, err = fmt.Fprintf(fOut, "    Couldn't compare branch '%s' with %s: %s.  Use --local to skip this\n",
+			branch, cloud, err)
+		return err
+	}
+	if !onCloud {
+		_, err = fmt.Fprintf(fOut, "    Database isn't on %s yet\n", cloud)
+		return err
+	}
+	remoteBranch, ok := remoteMeta.Branches[branch]
+	if !ok {
+		_, err = fmt.Fprintf(fOut, "    Branch '%s' isn't on %s yet\n", branch, cloud)
+		return err
+	}
+
+	// Count the commits each branch has which the other doesn't
+	ahead := countCommitsUntil(meta, localBranch.Commit, remoteMeta, remoteBranch.Commit)
+	behind := countCommitsUntil(remoteMeta, remoteBranch.Commit, meta, localBranch.Commit)
+	switch {
+	case ahead == 0 && behind == 0:
+		_, err = fmt.Fprintf(fOut, "    Branch '%s' is up to date with %s\n", branch, cloud)
+	case behind == 0:
+		_, err = fmt.Fprintf(fOut, "    Branch '%s' is ahead of %s by %d commit(s)\n", branch, cloud, ahead)
+	case ahead == 0:
+		_, err = fmt.Fprintf(fOut, "    Branch '%s' is behind %s by %d commit(s)\n", branch, cloud, behind)
+	default:
+		_, err = fmt.Fprintf(fOut, "    Branch '%s' has diverged from %s, with %d local and %d remote commit(s) "+
+			"not in the other\n", branch, cloud, ahead, behind)
+	}
 	return err
 }
+
+// Counts the commits from "head" back through its parents, stopping at the first one which is also in the history
+// of "otherHead"
+func countCommitsUntil(meta metaData, head string, otherMeta metaData, otherHead string) (count int) {
+	for c, ok := meta.Commits[head]; ok; c, ok = meta.Commits[c.Parent] {
+		if isAncestor(otherMeta, c.ID, otherHead) {
+			return
+		}
+		count++
+	}
+	return
+}
@@ -98,6 +98,12 @@ func tagCreate(args []string) error {
 		return errors.New("A tag with that name already exists")
 	}
 
+	// Make sure the commit being tagged exists.  Tags are immutable, so pointing one at a missing commit can't be
+	// fixed up later
+	if _, ok := meta.Commits[tagCreateCommit]; ok == false {
+		return errors.New("That commit ID doesn't exist")
+	}
+
 	// Generate the new tag info locally
 	newTag := tagEntry{
 		Commit:      tagCreateCommit,
@@ -9,6 +9,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var tagListShort bool
+
 // Displays the list of tags for a remote database
 var tagListCmd = &cobra.Command{
 	Use:   "tags [database name]",
@@ -20,6 +22,7 @@ var tagListCmd = &cobra.Command{
 
 func init() {
 	RootCmd.AddCommand(tagListCmd)
+	tagListCmd.Flags().BoolVar(&tagListShort, "short", false, "Display commit IDs in short form")
 }
 
 func tagList(args []string) error {
@@ -68,7 +71,11 @@ func tagList(args []string) error {
 		return err
 	}
 	for _, i := range sortedKeys {
-		_, err = fmt.Fprintf(fOut, "  * '%s' : commit %s\n\n", i, meta.Tags[i].Commit)
+		commitID := meta.Tags[i].Commit
+		if tagListShort {
+			commitID = shortID(commitID)
+		}
+		_, err = fmt.Fprintf(fOut, "  * '%s' : commit %s\n\n", i, commitID)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"regexp"
+
+	rq "github.com/parnurzeal/gorequest"
+)
+
+// Loads the Certificate Authority chain and client certificate files, returning a TLS configuration suitable for
+// talking to a DBHub.io cloud
+func loadTLSConfig(caChainFile string, certFile string) (conf tls.Config, err error) {
+	// Read the CA chain
+	ourCAPool := x509.NewCertPool()
+	chainFile, err := ioutil.ReadFile(caChainFile)
+	if err != nil {
+		return
+	}
+	ok := ourCAPool.AppendCertsFromPEM(chainFile)
+	if !ok {
+		err = errors.New("Error when loading certificate chain file")
+		return
+	}
+
+	// Load the client certificate file
+	if _, err = os.Stat(certFile); err != nil {
+		err = fmt.Errorf("Client certificate file '%s' couldn't be read.  Please download your client "+
+			"certificate from DBHub.io, then update the configuration file with its path", certFile)
+		return
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, certFile)
+	if err != nil {
+		return
+	}
+
+	// Use our self signed CA Cert chain, and set TLS1.2 as minimum
+	conf = tls.Config{
+		Certificates:             []tls.Certificate{cert},
+		ClientCAs:                ourCAPool,
+		InsecureSkipVerify:       true,
+		MinVersion:               tls.VersionTLS12,
+		PreferServerCipherSuites: true,
+		RootCAs:                  ourCAPool,
+	}
+	return
+}
+
+// Returns a new request agent, set up to use our TLS configuration and the network timeout
+func newTLSClient() (*rq.SuperAgent, error) {
+	if len(TLSConfig.Certificates) == 0 {
+		return nil, errors.New("No client certificate has been loaded.  Can't proceed.")
+	}
+	return withDebug(rq.New().TLSClientConfig(&TLSConfig).Timeout(timeout)), nil
+}
+
+// Returns the parsed client certificate from our TLS configuration, along with the ID used to identify its key in
+// commit signatures
+func clientCertificate() (cert *x509.Certificate, keyID string, err error) {
+	if len(TLSConfig.Certificates) == 0 || len(TLSConfig.Certificates[0].Certificate) == 0 {
+		err = errors.New("No client certificate has been loaded.  Can't sign or check commits.")
+		return
+	}
+	cert, err = x509.ParseCertificate(TLSConfig.Certificates[0].Certificate[0])
+	if err != nil {
+		return
+	}
+	s := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	keyID = hex.EncodeToString(s[:])
+	return
+}
+
+// Signs a commit ID with the private key of our client certificate.  The signature is returned base64 encoded
+func signCommit(c commitEntry) (sig string, keyID string, err error) {
+	_, keyID, err = clientCertificate()
+	if err != nil {
+		return
+	}
+	signer, ok := TLSConfig.Certificates[0].PrivateKey.(crypto.Signer)
+	if !ok {
+		err = errors.New("The private key of the client certificate can't be used for signing")
+		return
+	}
+	digest := sha256.Sum256([]byte(c.ID))
+	b, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return
+	}
+	sig = base64.StdEncoding.EncodeToString(b)
+	return
+}
+
+// Checks the signature of a commit against the public key of our client certificate
+func verifyCommitSignature(c commitEntry) (err error) {
+	cert, _, err := clientCertificate()
+	if err != nil {
+		return
+	}
+	sig, err := base64.StdEncoding.DecodeString(c.Signature)
+	if err != nil {
+		return
+	}
+	digest := sha256.Sum256([]byte(c.ID))
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+	case *ecdsa.PublicKey:
+		var esig struct{ R, S *big.Int }
+		_, err = asn1.Unmarshal(sig, &esig)
+		if err != nil {
+			return
+		}
+		if !ecdsa.Verify(pub, digest[:], esig.R, esig.S) {
+			err = errors.New("ECDSA verification error")
+		}
+	default:
+		err = errors.New("Unsupported public key type")
+	}
+	return
+}
+
+// Adds the API token (if one was given) to a request.  This is done per request, as the request agent clears its
+// headers when a new request is started
+func withToken(req *rq.SuperAgent) *rq.SuperAgent {
+	if apiToken != "" {
+		req.Set("Authorization", "Bearer "+apiToken)
+	}
+	return req
+}
+
+// The most of each logged request or response shown with --verbose.  Uploads and downloads include the whole database
+// file, which isn't useful to see
+const maxDebugLen = 4096
+
+var debugAuthHeader = regexp.MustCompile(`(?m)^(Authorization|Cookie|Set-Cookie): .*$`)
+
+// Writes the request agent's debug output, hiding the API token and cutting off large bodies
+type debugWriter struct {
+	out io.Writer
+}
+
+func (w debugWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	b := debugAuthHeader.ReplaceAll(p, []byte("$1: [redacted]"))
+	if len(b) > maxDebugLen {
+		b = append(b[:maxDebugLen:maxDebugLen], numFormat.Sprintf("\n... (%d more bytes not shown)\n",
+			len(b)-maxDebugLen)...)
+	}
+	_, err := w.out.Write(b)
+	return n, err
+}
+
+// Turns on logging of the HTTP requests and responses for a request agent, if --verbose was given
+func withDebug(req *rq.SuperAgent) *rq.SuperAgent {
+	if verbose {
+		req.SetDebug(true).SetLogger(log.New(debugWriter{out: debugOut}, "", log.LstdFlags))
+	}
+	return req
+}
@@ -9,21 +9,26 @@ type branchEntry struct {
 }
 
 type commitEntry struct {
-	AuthorEmail    string    `json:"author_email"`
-	AuthorName     string    `json:"author_name"`
-	CommitterEmail string    `json:"committer_email"`
-	CommitterName  string    `json:"committer_name"`
-	ID             string    `json:"id"`
-	Message        string    `json:"message"`
-	OtherParents   []string  `json:"other_parents"`
-	Parent         string    `json:"parent"`
-	Timestamp      time.Time `json:"timestamp"`
-	Tree           dbTree    `json:"tree"`
+	AuthorEmail        string    `json:"author_email"`
+	AuthorName         string    `json:"author_name"`
+	AuthorTimestamp    time.Time `json:"author_timestamp"` // If zero, Timestamp is used instead
+	CommitterEmail     string    `json:"committer_email"`
+	CommitterName      string    `json:"committer_name"`
+	CommitterTimestamp time.Time `json:"committer_timestamp"` // If zero, Timestamp is used instead
+	ID                 string    `json:"id"`
+	Message            string    `json:"message"`
+	OtherParents       []string  `json:"other_parents"`
+	Parent             string    `json:"parent"`
+	Signature          string    `json:"signature"` // Not part of the commit ID, so signing doesn't change it
+	SigningKeyID       string    `json:"signing_key_id"`
+	Timestamp          time.Time `json:"timestamp"`
+	Tree               dbTree    `json:"tree"`
 }
 
 type dbListEntry struct {
 	CommitID     string `json:"commit_id"`
 	DefBranch    string `json:"default_branch"`
+	Description  string `json:"description"`
 	LastModified string `json:"last_modified"`
 	Licence      string `json:"licence"`
 	Name         string `json:"name"`
@@ -72,12 +77,21 @@ type licenceEntry struct {
 type metaData struct {
 	ActiveBranch string                  `json:"active_branch"` // The local branch
 	Branches     map[string]branchEntry  `json:"branches"`
+	CheckedOut   string                  `json:"checked_out,omitempty"` // Commit checked out, if not the branch head
 	Commits      map[string]commitEntry  `json:"commits"`
 	DefBranch    string                  `json:"default_branch"` // The default branch *on the server*
+	Protected    []string                `json:"protected_branches,omitempty"`
 	Releases     map[string]releaseEntry `json:"releases"`
 	Tags         map[string]tagEntry     `json:"tags"`
 }
 
+type reflogEntry struct {
+	Action    string    `json:"action"` // The dio command which moved the branch head
+	NewCommit string    `json:"new_commit"`
+	OldCommit string    `json:"old_commit"` // Empty when the branch was created
+	Timestamp time.Time `json:"timestamp"`
+}
+
 type releaseEntry struct {
 	Commit        string    `json:"commit"`
 	Date          time.Time `json:"date"`
@@ -94,3 +108,9 @@ type tagEntry struct {
 	TaggerEmail string    `json:"email"`
 	TaggerName  string    `json:"name"`
 }
+
+type whoamiEntry struct {
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// Checks the local metadata and database cache for a database haven't been corrupted
+var verifyCmd = &cobra.Command{
+	Use:   "verify [database name]",
+	Short: "Check the integrity of the local metadata and database cache",
+	Long: `Recalculates the ID of every commit and tree in the local metadata, and the checksum of every cached
+database file, reporting any which don't match what's stored.  Parent commits, branches, tags, and releases
+pointing at commits which aren't in the metadata are reported too.  Commits signed with the key of your client
+certificate also have their signature checked.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return verify(args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(verifyCmd)
+}
+
+func verify(args []string) error {
+	// Ensure a database file was given
+	var db string
+	var err error
+	if len(args) == 0 {
+		db, err = getDefaultDatabase()
+		if err != nil {
+			return err
+		}
+		if db == "" {
+			// No database name was given on the command line, and we don't have a default database selected
+			return errors.New("No database file specified")
+		}
+	} else {
+		db = args[0]
+	}
+	if len(args) > 1 {
+		return errors.New("Only one database can be verified at a time (for now)")
+	}
+
+	// Load the local metadata
+	if _, err = os.Stat(filepath.Join(".dio", db, "metadata.json")); os.IsNotExist(err) {
+		return fmt.Errorf("No local metadata for '%s' exists", db)
+	}
+	meta, err := localFetchMetadata(db, false)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "Verifying '%s'\n\n", db)
+	if err != nil {
+		return err
+	}
+
+	// Check each of the commits, and the tree they point to
+	var sortedKeys []string
+	for k := range meta.Commits {
+		sortedKeys = append(sortedKeys, k)
+	}
+	sort.Strings(sortedKeys)
+	var ourKeyID string
+	if _, keyID, err := clientCertificate(); err == nil {
+		ourKeyID = keyID
+	}
+	var problems int
+	for _, id := range sortedKeys {
+		c := meta.Commits[id]
+		if id != c.ID {
+			_, err = fmt.Fprintf(fOut, "  * Commit %s: stored under a different ID (%s)\n", c.ID, id)
+			if err != nil {
+				return err
+			}
+			problems++
+		}
+		if treeID := createDBTreeID(c.Tree.Entries); treeID != c.Tree.ID {
+			_, err = fmt.Fprintf(fOut, "  * Tree %s (commit %s): contents have ID %s\n", c.Tree.ID, id, treeID)
+			if err != nil {
+				return err
+			}
+			problems++
+		}
+		if comID := createCommitID(c); comID != c.ID {
+			_, err = fmt.Fprintf(fOut, "  * Commit %s: contents have ID %s\n", c.ID, comID)
+			if err != nil {
+				return err
+			}
+			problems++
+		}
+
+		// Parent commits which are missing would break walking back through the history
+		for _, p := range append([]string{c.Parent}, c.OtherParents...) {
+			if _, ok := meta.Commits[p]; p != "" && !ok {
+				_, err = fmt.Fprintf(fOut, "  * Commit %s: parent commit %s isn't in the commit list\n", c.ID, p)
+				if err != nil {
+					return err
+				}
+				problems++
+			}
+		}
+
+		// Signatures can only be checked for commits signed with our own client certificate
+		if c.Signature != "" && c.SigningKeyID == ourKeyID {
+			if err = verifyCommitSignature(c); err != nil {
+				_, err = fmt.Fprintf(fOut, "  * Commit %s: signature doesn't match\n", c.ID)
+				if err != nil {
+					return err
+				}
+				problems++
+			}
+		}
+	}
+
+	// Check the branches, tags, and releases all point at known commits
+	refs := make(map[string]string)
+	for name, br := range meta.Branches {
+		refs["Branch '"+name+"'"] = br.Commit
+	}
+	for name, t := range meta.Tags {
+		refs["Tag '"+name+"'"] = t.Commit
+	}
+	for name, r := range meta.Releases {
+		refs["Release '"+name+"'"] = r.Commit
+	}
+	var refNames []string
+	for k := range refs {
+		refNames = append(refNames, k)
+	}
+	sort.Strings(refNames)
+	for _, k := range refNames {
+		if _, ok := meta.Commits[refs[k]]; !ok {
+			_, err = fmt.Fprintf(fOut, "  * %s: commit %s isn't in the commit list\n", k, refs[k])
+			if err != nil {
+				return err
+			}
+			problems++
+		}
+	}
+
+	// Check the cached database files match the checksum they're named after
+	files, err := ioutil.ReadDir(filepath.Join(".dio", db, "db"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, j := range files {
+		if j.IsDir() {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(".dio", db, "db", j.Name()))
+		if err != nil {
+			return err
+		}
+		s := sha256.Sum256(b)
+		if shaSum := hex.EncodeToString(s[:]); shaSum != j.Name() {
+			_, err = fmt.Fprintf(fOut, "  * Database file %s: contents have checksum %s\n", j.Name(), shaSum)
+			if err != nil {
+				return err
+			}
+			problems++
+		}
+	}
+
+	if problems != 0 {
+		return fmt.Errorf("%d problem(s) found in the local data for '%s'", problems, db)
+	}
+	_, err = numFormat.Fprintf(fOut, "  No problems found in %d commit(s) and %d cached database file(s)\n",
+		len(meta.Commits), len(files))
+	return err
+}
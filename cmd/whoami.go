@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var whoamiCmdLocal bool
+
+// Displays the identity dio is using, both locally and as seen by the server
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Display who you are identified as, and the author details your commits will use",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return whoami()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(whoamiCmd)
+	whoamiCmd.Flags().BoolVar(&whoamiCmdLocal, "local", false,
+		"Only show the local details, without asking the server")
+}
+
+func whoami() error {
+	// Display the details from the client certificate and config file
+	user, certEmail, certServer, err := getUserAndServer()
+	if err != nil {
+		return err
+	}
+	var name, email string
+	if z, ok := viper.Get("user.name").(string); ok {
+		name = z
+	}
+	if z, ok := viper.Get("user.email").(string); ok {
+		email = z
+	}
+	_, err = fmt.Fprintln(fOut, "Local identity:")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Username: %s\n", user)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Certificate: %s (for %s)\n", certEmail, certServer)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Commit author: %s <%s>\n", name, email)
+	if err != nil {
+		return err
+	}
+	if whoamiCmdLocal {
+		return nil
+	}
+
+	// Ask the server who it thinks we are
+	client, err := newTLSClient()
+	if err != nil {
+		return err
+	}
+	resp, body, errs := withToken(client.Get(cloud+"/whoami").
+		Set("User-Agent", fmt.Sprintf("Dio %s", DIO_VERSION))).
+		End()
+	if errs != nil {
+		if err = timeoutError(errs); err != nil {
+			return err
+		}
+		e := fmt.Sprintln("Errors when retrieving your identity from the server:")
+		for _, err := range errs {
+			e += err.Error()
+		}
+		return errors.New(e)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_, err = fmt.Fprintf(fOut, "\n%s doesn't support looking up your identity\n", cloud)
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Couldn't retrieve your identity from %s: HTTP status %d - '%v'", cloud,
+			resp.StatusCode, resp.Status)
+	}
+	var id whoamiEntry
+	err = json.Unmarshal([]byte(body), &id)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "\nIdentity on %s:\n", cloud)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Username: %s\n", id.Username)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Name: %s\n", id.Name)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fOut, "  * Email: %s\n", id.Email)
+	if err != nil {
+		return err
+	}
+	if id.Username != user {
+		_, err = fmt.Fprintf(fOut, "\n  Warning: the server knows you as '%s', not '%s'\n", id.Username,
+			user)
+	}
+	return err
+}